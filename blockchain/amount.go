@@ -0,0 +1,186 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Amount is a number of base units. One coin is Coin base units, so amounts
+// are shown with AmountDecimals decimals.
+type Amount uint64
+
+const (
+	AmountDecimals = 8
+
+	Coin     Amount = 100000000
+	MaxMoney Amount = 21000000 * Coin
+)
+
+// ParseAmount reads a decimal number of coins such as "1.25". At most
+// AmountDecimals decimals are allowed and the result may not exceed
+// MaxMoney.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || hasFraction && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > AmountDecimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimals", s, AmountDecimals)
+	}
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	var coins uint64
+	if whole != "" {
+		var err error
+		coins, err = strconv.ParseUint(whole, 10, 64)
+		if err != nil || coins > uint64(MaxMoney/Coin) {
+			return 0, fmt.Errorf("amount %q exceeds the maximum of %s", s, MaxMoney)
+		}
+	}
+
+	var units uint64
+	if fraction != "" {
+		units, _ = strconv.ParseUint(fraction+strings.Repeat("0", AmountDecimals-len(fraction)), 10, 64)
+	}
+
+	amount, err := Amount(units).Add(Amount(coins) * Coin)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q exceeds the maximum of %s", s, MaxMoney)
+	}
+
+	return amount, nil
+}
+
+func (a Amount) String() string {
+	coins := a / Coin
+	units := a % Coin
+	if units == 0 {
+		return strconv.FormatUint(uint64(coins), 10)
+	}
+
+	fraction := fmt.Sprintf("%0*d", AmountDecimals, uint64(units))
+	return fmt.Sprintf("%d.%s", uint64(coins), strings.TrimRight(fraction, "0"))
+}
+
+// MarshalJSON writes the amount as a decimal number of coins.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a decimal number of coins, bare or quoted.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	return a.Set(strings.Trim(string(data), `"`))
+}
+
+// Set lets an *Amount be used as a command line flag.
+func (a *Amount) Set(s string) error {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = amount
+	return nil
+}
+
+// Add returns a + b, failing when the sum exceeds MaxMoney.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a > MaxMoney || b > MaxMoney-a {
+		return 0, fmt.Errorf("sum of %s and %s exceeds the maximum of %s", a, b, MaxMoney)
+	}
+
+	return a + b, nil
+}
+
+// Sub returns a - b, failing when b is larger than a.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, fmt.Errorf("cannot subtract %s from %s", b, a)
+	}
+
+	return a - b, nil
+}
+
+// SumAmounts adds up amounts with the same checks as Add.
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
+// saturatingAdd is used where only comparisons against a valid amount
+// follow, such as in coin selection, so capping the sum is harmless.
+func saturatingAdd(a, b Amount) Amount {
+	if b > math.MaxUint64-a {
+		return math.MaxUint64
+	}
+
+	return a + b
+}
+
+// FeeRate is a fee in base units per 1000 bytes of serialized transaction.
+type FeeRate uint64
+
+func NewFeeRate(fee Amount, size int) FeeRate {
+	if size <= 0 {
+		return 0
+	}
+
+	hi, lo := bits.Mul64(uint64(fee), 1000)
+	if hi != 0 {
+		return math.MaxUint64
+	}
+
+	return FeeRate(lo / uint64(size))
+}
+
+// Fee is the fee for size bytes, rounded up to a whole base unit.
+func (r FeeRate) Fee(size int) Amount {
+	hi, lo := bits.Mul64(uint64(r), uint64(size))
+	if hi != 0 || lo > math.MaxUint64-999 {
+		return math.MaxUint64
+	}
+
+	return Amount((lo + 999) / 1000)
+}
+
+func (r FeeRate) String() string {
+	return Amount(r).String() + "/kB"
+}
+
+// Set reads a rate in coins per 1000 bytes, so a FeeRate can be a flag.
+func (r *FeeRate) Set(s string) error {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*r = FeeRate(amount)
+	return nil
+}
+
+// MarshalJSON writes the rate as a bare decimal number of coins per 1000
+// bytes.
+func (r FeeRate) MarshalJSON() ([]byte, error) {
+	return []byte(Amount(r).String()), nil
+}
+
+func (r *FeeRate) UnmarshalJSON(data []byte) error {
+	return r.Set(strings.Trim(string(data), `"`))
+}
@@ -2,7 +2,7 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
+	"fmt"
 	"time"
 
 	"crypto/sha256"
@@ -14,28 +14,34 @@ type Block struct {
 	Transactions []*Transaction
 	Hash         []byte
 	Nonce        int
+	Height       int
 }
 
 func Genesis(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{})
+	return NewBlock([]*Transaction{coinbase}, []byte{}, 0)
 }
 
-func NewBlock(txs []*Transaction, prevHash []byte) *Block {
+func NewBlock(txs []*Transaction, prevHash []byte, height int) *Block {
 	block := &Block{
 		Timestamp:    uint(time.Now().Unix()),
 		PrevHash:     prevHash,
 		Transactions: txs,
 		Nonce:        0,
+		Height:       height,
 	}
-	pow := NewProof(block)
-	nonce, hash := pow.Run()
-
-	block.Hash = hash
-	block.Nonce = nonce
+	block.Mine()
 
 	return block
 }
 
+// Mine runs the proof of work and sets the nonce and hash it finds.
+func (b *Block) Mine() {
+	nonce, hash := NewProof(b).Run()
+
+	b.Hash = hash
+	b.Nonce = nonce
+}
+
 func (b *Block) HashTransaction() []byte {
 	var txHashes [][]byte
 	var txHash [32]byte
@@ -49,22 +55,34 @@ func (b *Block) HashTransaction() []byte {
 	return txHash[:]
 }
 
-func (b *Block) Serialize() []byte {
-	var result bytes.Buffer
+// HashWitnesses commits the block to the witnesses of its transactions,
+// which HashTransaction leaves out.
+func (b *Block) HashWitnesses() []byte {
+	var witnessHashes [][]byte
+
+	for _, tx := range b.Transactions {
+		witnessHashes = append(witnessHashes, tx.WitnessHash())
+	}
 
-	encoder := gob.NewEncoder(&result)
-	err := encoder.Encode(b)
-	HandleFatalErrors(err)
+	hash := sha256.Sum256(bytes.Join(witnessHashes, []byte{}))
 
-	return result.Bytes()
+	return hash[:]
 }
 
-func Deserialize(data []byte) *Block {
-	var block Block
+func (b *Block) Serialize() []byte {
+	var e encoder
+	e.putBlock(b)
+
+	return e.Bytes()
+}
 
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&block)
-	HandleFatalErrors(err)
+// Deserialize decodes a block in the binary encoding.
+func Deserialize(data []byte) (*Block, error) {
+	d := newDecoder(data)
+	block := d.block()
+	if err := d.Finish("block"); err != nil {
+		return nil, fmt.Errorf("invalid block: %v", err)
+	}
 
-	return &block
+	return block, nil
 }
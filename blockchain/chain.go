@@ -2,13 +2,13 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
 	"os"
 	"runtime"
 
 	badger "github.com/dgraph-io/badger/v3"
+	"github.com/goozt/seashell/wallet"
 )
 
 const (
@@ -22,6 +22,8 @@ var lastHashByte = []byte("lh")
 type BlockChain struct {
 	LastHash []byte
 	Database *badger.DB
+
+	orphans *orphanPool
 }
 
 type BlockChainIterator struct {
@@ -58,7 +60,42 @@ func InitBlockChain(enableLog bool, address string) *BlockChain {
 
 	HandleFatalErrors(err)
 
-	return &BlockChain{lastHash, db}
+	return &BlockChain{lastHash, db, newOrphanPool(MaxOrphanBlocks)}
+}
+
+// InitBlockChainFromGenesis starts a chain with the genesis block of
+// another node, so that the two can exchange blocks.
+func InitBlockChainFromGenesis(genesis *Block) (*BlockChain, error) {
+	if DbExists() {
+		return nil, fmt.Errorf("blockchain already exists")
+	}
+	if len(genesis.PrevHash) != 0 || genesis.Height != 0 {
+		return nil, fmt.Errorf("block %x is not a genesis block", genesis.Hash)
+	}
+	if err := checkProofOfWork(genesis); err != nil {
+		return nil, err
+	}
+
+	_ = os.MkdirAll(dbPath, 0700)
+	opts := badger.DefaultOptions(dbPath)
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(genesis.Hash, genesis.Serialize()); err != nil {
+			return err
+		}
+		return txn.Set(lastHashByte, genesis.Hash)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BlockChain{genesis.Hash, db, newOrphanPool(MaxOrphanBlocks)}, nil
 }
 
 func ContinueBlockChain(enableLog bool, address string) *BlockChain {
@@ -86,36 +123,106 @@ func ContinueBlockChain(enableLog bool, address string) *BlockChain {
 
 	HandleFatalErrors(err)
 
-	return &BlockChain{lastHash, db}
+	return &BlockChain{lastHash, db, newOrphanPool(MaxOrphanBlocks)}
 }
 
 func (chain *BlockChain) Close() error {
 	return chain.Database.Close()
 }
 
-func (chain *BlockChain) AddBlock(txs []*Transaction) {
-	var lastHash []byte
+// checkBlockTransactions validates txs for a block at height whose parent
+// has medianTime. A coinbase is optional, but has to come first and may
+// claim no more than the subsidy and the fees of the block.
+func (chain *BlockChain) checkBlockTransactions(txs []*Transaction, height int, medianTime int64) error {
+	spent := make(map[string]bool)
+	pending := make(map[string]*Transaction)
+	var checks []inputCheck
+	var fees Amount
+	size := 0
+
+	for txId, tx := range txs {
+		if size += tx.Size(); size > MaxBlockSize {
+			return fmt.Errorf("transactions exceed the block size limit of %d bytes", MaxBlockSize)
+		}
+		if err := tx.CheckOutputs(); err != nil {
+			return err
+		}
+		if err := chain.checkTransactionLocks(tx, height, medianTime, pending); err != nil {
+			return err
+		}
 
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(lastHashByte)
-		HandleFatalErrors(err)
-		lastHash, err = item.ValueCopy(nil)
-		return err
-	})
-	HandleFatalErrors(err)
+		if tx.IsCoinbase() {
+			if txId != 0 {
+				return fmt.Errorf("coinbase transaction %x is not the first of the block", tx.Id)
+			}
+		} else {
+			prevTxs, err := chain.previousTransactions(tx, pending)
+			if err != nil {
+				return err
+			}
+			fee, err := chain.checkTransactionInputs(tx, prevTxs, spent)
+			if err != nil {
+				return err
+			}
+			if fees, err = fees.Add(fee); err != nil {
+				return err
+			}
+			txChecks, err := tx.inputChecks(prevTxs)
+			if err != nil {
+				return err
+			}
+			checks = append(checks, txChecks...)
+		}
 
-	newBlock := NewBlock(txs, lastHash)
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err = txn.Set(newBlock.Hash, newBlock.Serialize())
-		HandleFatalErrors(err)
-		err = txn.Set(lastHashByte, newBlock.Hash)
-		chain.LastHash = newBlock.Hash
+		pending[hex.EncodeToString(tx.Id)] = tx
+	}
+
+	if len(txs) > 0 && txs[0].IsCoinbase() {
+		if err := checkCoinbaseValue(txs[0], fees); err != nil {
+			return err
+		}
+	}
+
+	return verifyInputs(checks, VerifiedInputs)
+}
+
+func checkCoinbaseValue(coinbase *Transaction, fees Amount) error {
+	var reward Amount
+	for _, out := range coinbase.Outputs {
+		var err error
+		if reward, err = reward.Add(out.Value); err != nil {
+			return err
+		}
+	}
+
+	limit, err := Subsidy.Add(fees)
+	if err != nil {
 		return err
+	}
+	if reward > limit {
+		return fmt.Errorf("coinbase transaction %x claims %s, more than the subsidy and fees of %s", coinbase.Id, reward, limit)
+	}
+
+	return nil
+}
+
+// storeBlock saves block as the new last block.
+func (chain *BlockChain) storeBlock(block *Block) error {
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		if err := chain.putBlock(txn, block); err != nil {
+			return err
+		}
+		if err := txn.Set(lastHashByte, block.Hash); err != nil {
+			return err
+		}
+		chain.LastHash = block.Hash
+
+		return nil
 	})
 }
 
-func (chain *BlockChain) FindUnspentTransactions(publicKeyHash []byte) []Transaction {
-	var unspentTxs []Transaction
+func (chain *BlockChain) FindUnspentOutputs(publicKeyHash []byte) []UnspentOutput {
+	var unspentOuts []UnspentOutput
 
 	spentTxOs := make(map[string][]int)
 
@@ -124,28 +231,28 @@ func (chain *BlockChain) FindUnspentTransactions(publicKeyHash []byte) []Transac
 	for {
 		block := iter.Next()
 
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, in := range tx.Inputs {
+				inTxId := hex.EncodeToString(in.Id)
+				spentTxOs[inTxId] = append(spentTxOs[inTxId], in.Out)
+			}
+		}
+
 		for _, tx := range block.Transactions {
 			txId := hex.EncodeToString(tx.Id)
 
 		Outputs:
 			for outIdx, out := range tx.Outputs {
-				if spentTxOs[txId] != nil {
-					for _, spendOut := range spentTxOs[txId] {
-						if spendOut == outIdx {
-							continue Outputs
-						}
+				for _, spentOut := range spentTxOs[txId] {
+					if spentOut == outIdx {
+						continue Outputs
 					}
 				}
-				if out.IsLockedWithKey(publicKeyHash) {
-					unspentTxs = append(unspentTxs, *tx)
-				}
-				if !tx.IsCoinbase() {
-					for _, in := range tx.Inputs {
-						if in.UsesKey(publicKeyHash) {
-							inTxId := hex.EncodeToString(in.Id)
-							spentTxOs[inTxId] = append(spentTxOs[inTxId], in.Out)
-						}
-					}
+				if !out.Script.IsUnspendable() && out.IsLockedWithKey(publicKeyHash) {
+					unspentOuts = append(unspentOuts, UnspentOutput{tx.Id, outIdx, out})
 				}
 			}
 		}
@@ -155,49 +262,67 @@ func (chain *BlockChain) FindUnspentTransactions(publicKeyHash []byte) []Transac
 		}
 	}
 
-	return unspentTxs
+	return unspentOuts
 }
 
 func (chain *BlockChain) FindUTXO(publicKeyHash []byte) []TxOutput {
 	var UTXOs []TxOutput
-	unspentTransactions := chain.FindUnspentTransactions(publicKeyHash)
 
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Outputs {
-			if out.IsLockedWithKey(publicKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
+	for _, utxo := range chain.FindUnspentOutputs(publicKeyHash) {
+		UTXOs = append(UTXOs, utxo.Output)
 	}
 
 	return UTXOs
 }
 
-func (chain *BlockChain) FindSpendableOutputs(publicKeyHash []byte, amount int) (int, map[string][]int) {
+func (chain *BlockChain) FindSpendableOutputs(publicKeyHash []byte, amount Amount, selector CoinSelector) (Amount, map[string][]int) {
 	unspentOuts := make(map[string][]int)
-	unspentTxs := chain.FindUnspentTransactions(publicKeyHash)
-	accumulated := 0
+	var accumulated Amount
+
+	if selector == nil {
+		selector = DefaultCoinSelector
+	}
 
-Work:
-	for _, tx := range unspentTxs {
-		txId := hex.EncodeToString(tx.Id)
+	for _, utxo := range selector.Select(chain.FindUnspentOutputs(publicKeyHash), amount) {
+		txId := hex.EncodeToString(utxo.TxId)
+		accumulated = saturatingAdd(accumulated, utxo.Output.Value)
+		unspentOuts[txId] = append(unspentOuts[txId], utxo.Index)
+	}
 
-		for outIdx, out := range tx.Outputs {
-			if out.IsLockedWithKey(publicKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOuts[txId] = append(unspentOuts[txId], outIdx)
+	return accumulated, unspentOuts
+}
+
+func (chain *BlockChain) IsSpent(id []byte, out int) bool {
+	iter := chain.Iterator()
 
-				if accumulated >= amount {
-					break Work
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, in := range tx.Inputs {
+				if bytes.Equal(in.Id, id) && in.Out == out {
+					return true
 				}
 			}
 		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
 	}
 
-	return accumulated, unspentOuts
+	return false
 }
 
 func (chain *BlockChain) FindTransaction(id []byte) (Transaction, error) {
+	tx, _, err := chain.FindTransactionBlock(id)
+	return tx, err
+}
+
+func (chain *BlockChain) FindTransactionBlock(id []byte) (Transaction, *Block, error) {
 	iter := chain.Iterator()
 
 	for {
@@ -205,7 +330,7 @@ func (chain *BlockChain) FindTransaction(id []byte) (Transaction, error) {
 
 		for _, tx := range block.Transactions {
 			if bytes.Equal(tx.Id, id) {
-				return *tx, nil
+				return *tx, block, nil
 			}
 		}
 
@@ -214,33 +339,169 @@ func (chain *BlockChain) FindTransaction(id []byte) (Transaction, error) {
 		}
 	}
 
-	return Transaction{}, fmt.Errorf("transaction does not exists")
+	return Transaction{}, nil, fmt.Errorf("transaction does not exists")
 }
 
-func (bc *BlockChain) SignTransaction(tx *Transaction, privateKey ecdsa.PrivateKey) {
-	prevTxs := make(map[string]Transaction)
+func (chain *BlockChain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
 
-	for _, in := range tx.Inputs {
-		prevTx, err := bc.FindTransaction(in.Id)
-		HandleFatalErrors(err)
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(hash)
+		if err != nil {
+			return err
+		}
+		encodedBlock, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		block, err = Deserialize(encodedBlock)
 
-		prevTxs[hex.EncodeToString(in.Id)] = prevTx
+		return err
+	})
+
+	return block, err
+}
+
+func (chain *BlockChain) Height() int {
+	block, err := chain.GetBlock(chain.LastHash)
+	HandleFatalErrors(err)
+
+	return block.Height
+}
+
+func (bc *BlockChain) SignTransaction(tx *Transaction, w wallet.Wallet) error {
+	prevTxs, err := bc.PreviousTransactions(tx)
+	if err != nil {
+		return err
 	}
 
-	tx.Sign(privateKey, prevTxs)
+	return tx.Sign(w, prevTxs)
 }
 
 func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
+	return bc.VerifyTransactions([]*Transaction{tx}) == nil
+}
+
+// VerifyTransactions checks the scripts of every input of txs together, so
+// the checks of a whole block share one worker pool.
+func (bc *BlockChain) VerifyTransactions(txs []*Transaction) error {
+	var checks []inputCheck
+
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		prevTxs, err := bc.PreviousTransactions(tx)
+		if err != nil {
+			return err
+		}
+		txChecks, err := tx.inputChecks(prevTxs)
+		if err != nil {
+			return err
+		}
+		checks = append(checks, txChecks...)
+	}
+
+	return verifyInputs(checks, VerifiedInputs)
+}
+
+// ValidateTransaction runs every check a transaction has to pass before it
+// can be mined in a block at height.
+func (bc *BlockChain) ValidateTransaction(tx *Transaction, height int, medianTime int64) error {
+	if tx.IsCoinbase() {
+		return fmt.Errorf("coinbase transaction %x cannot be mined on its own", tx.Id)
+	}
+	if err := tx.CheckOutputs(); err != nil {
+		return err
+	}
+	if _, err := bc.CheckTransactionInputs(tx); err != nil {
+		return err
+	}
+	if err := bc.CheckTransactionLocks(tx, height, medianTime); err != nil {
+		return err
+	}
+
+	return bc.VerifyTransactions([]*Transaction{tx})
+}
+
+// CheckTransactionInputs makes sure every input spends an existing unspent
+// output, no output twice, and that the inputs cover the outputs. It
+// returns the fee, the input value left over.
+func (bc *BlockChain) CheckTransactionInputs(tx *Transaction) (Amount, error) {
+	prevTxs, err := bc.PreviousTransactions(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return bc.checkTransactionInputs(tx, prevTxs, make(map[string]bool))
+}
+
+// checkTransactionInputs checks tx against prevTxs, treating the outpoints
+// in spent as spent as well, and adds the outpoints of tx to spent.
+func (bc *BlockChain) checkTransactionInputs(tx *Transaction, prevTxs map[string]Transaction, spent map[string]bool) (Amount, error) {
+	var inputValue Amount
+	var err error
+
+	for inId, in := range tx.Inputs {
+		prevTx := prevTxs[hex.EncodeToString(in.Id)]
+		if in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+			return 0, fmt.Errorf("input %d spends missing output %x:%d", inId, in.Id, in.Out)
+		}
+
+		point := outpoint(in.Id, in.Out)
+		if spent[point] || bc.IsSpent(in.Id, in.Out) {
+			return 0, fmt.Errorf("input %d spends %s which is already spent", inId, point)
+		}
+		spent[point] = true
+
+		inputValue, err = inputValue.Add(prevTx.Outputs[in.Out].Value)
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %v", inId, err)
+		}
+	}
+
+	var outputValue Amount
+	for outId, out := range tx.Outputs {
+		outputValue, err = outputValue.Add(out.Value)
+		if err != nil {
+			return 0, fmt.Errorf("output %d: %v", outId, err)
+		}
+	}
+
+	fee, err := inputValue.Sub(outputValue)
+	if err != nil {
+		return 0, fmt.Errorf("outputs of %s exceed the inputs of %s", outputValue, inputValue)
+	}
+
+	return fee, nil
+}
+
+// PreviousTransactions looks up the transactions whose outputs tx spends.
+func (bc *BlockChain) PreviousTransactions(tx *Transaction) (map[string]Transaction, error) {
+	return bc.previousTransactions(tx, nil)
+}
+
+// previousTransactions looks in pending, transactions not yet in the
+// chain, before it searches the chain.
+func (bc *BlockChain) previousTransactions(tx *Transaction, pending map[string]*Transaction) (map[string]Transaction, error) {
 	prevTxs := make(map[string]Transaction)
 
-	for _, in := range tx.Inputs {
+	for inId, in := range tx.Inputs {
+		if prevTx, ok := pending[hex.EncodeToString(in.Id)]; ok {
+			prevTxs[hex.EncodeToString(in.Id)] = *prevTx
+			continue
+		}
+
 		prevTx, err := bc.FindTransaction(in.Id)
-		HandleFatalErrors(err)
+		if err != nil {
+			return nil, fmt.Errorf("input %d spends unknown transaction %x", inId, in.Id)
+		}
 
 		prevTxs[hex.EncodeToString(in.Id)] = prevTx
 	}
 
-	return tx.Verify(prevTxs)
+	return prevTxs, nil
 }
 
 func (chain *BlockChain) Iterator() *BlockChainIterator {
@@ -256,7 +517,8 @@ func (iter *BlockChainIterator) Next() *Block {
 		item, err := txn.Get(iter.CurrentHash)
 		HandleFatalErrors(err)
 		encodedBlock, err := item.ValueCopy(nil)
-		block = Deserialize(encodedBlock)
+		HandleFatalErrors(err)
+		block, err = Deserialize(encodedBlock)
 
 		return err
 	})
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const bnbMaxTries = 100000
+
+type UnspentOutput struct {
+	TxId   []byte
+	Index  int
+	Output TxOutput
+}
+
+// CoinSelector picks which unspent outputs fund a payment of amount.
+// If the outputs cannot cover the amount, the returned selection sums
+// to less than amount and the caller reports the shortfall.
+type CoinSelector interface {
+	Select(utxos []UnspentOutput, amount Amount) []UnspentOutput
+}
+
+type LargestFirstSelector struct{}
+
+type SmallestFirstSelector struct{}
+
+// BranchAndBoundSelector searches for a subset that matches the amount
+// exactly, so that no change output is needed. When no exact match
+// exists it defers to Fallback.
+type BranchAndBoundSelector struct {
+	Fallback CoinSelector
+}
+
+type RandomSelector struct {
+	Rand *rand.Rand
+}
+
+var DefaultCoinSelector CoinSelector = BranchAndBoundSelector{LargestFirstSelector{}}
+
+var CoinSelectors = []string{"bnb", "largest", "smallest", "random"}
+
+func NewCoinSelector(strategy string) (CoinSelector, error) {
+	switch strategy {
+	case "bnb":
+		return BranchAndBoundSelector{LargestFirstSelector{}}, nil
+	case "largest":
+		return LargestFirstSelector{}, nil
+	case "smallest":
+		return SmallestFirstSelector{}, nil
+	case "random":
+		return RandomSelector{rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+	}
+
+	return nil, fmt.Errorf("unknown coin selection strategy %q", strategy)
+}
+
+func (LargestFirstSelector) Select(utxos []UnspentOutput, amount Amount) []UnspentOutput {
+	sorted := sortedOutputs(utxos, func(a, b Amount) bool { return a > b })
+	return accumulate(sorted, amount)
+}
+
+func (SmallestFirstSelector) Select(utxos []UnspentOutput, amount Amount) []UnspentOutput {
+	sorted := sortedOutputs(utxos, func(a, b Amount) bool { return a < b })
+	return accumulate(sorted, amount)
+}
+
+func (s RandomSelector) Select(utxos []UnspentOutput, amount Amount) []UnspentOutput {
+	shuffled := append([]UnspentOutput{}, utxos...)
+	s.Rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulate(shuffled, amount)
+}
+
+func (s BranchAndBoundSelector) Select(utxos []UnspentOutput, amount Amount) []UnspentOutput {
+	sorted := sortedOutputs(utxos, func(a, b Amount) bool { return a > b })
+
+	remaining := make([]Amount, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = saturatingAdd(remaining[i+1], sorted[i].Output.Value)
+	}
+
+	var selected []int
+	tries := 0
+
+	var search func(idx int, total Amount) bool
+	search = func(idx int, total Amount) bool {
+		tries++
+		if total == amount {
+			return true
+		}
+		if total > amount || idx == len(sorted) || saturatingAdd(total, remaining[idx]) < amount || tries > bnbMaxTries {
+			return false
+		}
+
+		selected = append(selected, idx)
+		if search(idx+1, saturatingAdd(total, sorted[idx].Output.Value)) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		return search(idx+1, total)
+	}
+
+	if amount > 0 && search(0, 0) {
+		var exact []UnspentOutput
+		for _, idx := range selected {
+			exact = append(exact, sorted[idx])
+		}
+		return exact
+	}
+
+	fallback := s.Fallback
+	if fallback == nil {
+		fallback = LargestFirstSelector{}
+	}
+
+	return fallback.Select(utxos, amount)
+}
+
+func sortedOutputs(utxos []UnspentOutput, less func(a, b Amount) bool) []UnspentOutput {
+	sorted := append([]UnspentOutput{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i].Output.Value, sorted[j].Output.Value)
+	})
+	return sorted
+}
+
+func accumulate(utxos []UnspentOutput, amount Amount) []UnspentOutput {
+	var selected []UnspentOutput
+	var accumulated Amount
+
+	for _, utxo := range utxos {
+		if accumulated >= amount {
+			break
+		}
+		accumulated = saturatingAdd(accumulated, utxo.Output.Value)
+		selected = append(selected, utxo)
+	}
+
+	return selected
+}
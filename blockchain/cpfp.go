@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// NewChildPaysForParent spends the outputs of the pool transaction id that
+// pay the first of its wallet keys back to that key, with a fee that brings
+// id, its unconfirmed ancestors and the child together to rate. Confirmed
+// coins of the key are added when the outputs do not cover the fee.
+func (pool *Mempool) NewChildPaysForParent(id []byte, rate FeeRate) (*Transaction, error) {
+	entry, ok := pool.Entry(id)
+	if !ok {
+		return nil, fmt.Errorf("transaction %x is not in the memory pool", id)
+	}
+
+	var fees Amount
+	size := 0
+	for _, e := range append([]*MempoolEntry{entry}, pool.Ancestors(entry)...) {
+		fees = saturatingAdd(fees, e.Fee)
+		size += e.Size
+	}
+
+	walletDB, err := wallet.CreateWalletDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var required []UnspentOutput
+	var owner *wallet.Wallet
+	for outIdx, out := range entry.Tx.Outputs {
+		w, ok := walletDB.FindWallet(out.Script.PubKeyHash())
+		if !ok || owner != nil && w != owner || pool.IsSpent(id, outIdx) {
+			continue
+		}
+		owner = w
+		required = append(required, UnspentOutput{id, outIdx, out})
+	}
+	if owner == nil {
+		return nil, fmt.Errorf("transaction %x has no unspent output of this wallet", id)
+	}
+
+	// Only confirmed coins are added, so that the child does not pay for
+	// other packages as well.
+	var utxos []UnspentOutput
+	for _, utxo := range pool.FindUnspentOutputs(wallet.PublicKeyHash(owner.PublicKey)) {
+		if _, ok := pool.Entry(utxo.TxId); !ok {
+			utxos = append(utxos, utxo)
+		}
+	}
+
+	options := SendOptions{Replaceable: true}
+	child, err := fundTransaction(required, utxos, nil, string(owner.Address()), options, estimatedWitnessSize, func(childSize int) Amount {
+		fee := rate.Fee(childSize)
+		if needed := rate.Fee(size + childSize); needed > fees && needed-fees > fee {
+			return needed - fees
+		}
+		return fee
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prevTxs, err := pool.PreviousTransactions(child)
+	if err != nil {
+		return nil, err
+	}
+	if unsigned := child.SignWithWalletDB(walletDB, prevTxs); unsigned > 0 {
+		return nil, fmt.Errorf("%d inputs of the child could not be signed", unsigned)
+	}
+
+	return child, nil
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+func TestPackageFeeRates(t *testing.T) {
+	pool := testMempool(DefaultPolicy.MaxMempoolSize)
+
+	parent := addTestEntry(pool, nil, 500, 1000)
+	child := addTestEntry(pool, parent, 9500, 1000)
+	grandchild := addTestEntry(pool, child, 3000, 1000)
+	sibling := addTestEntry(pool, parent, 100, 1000)
+
+	tests := []struct {
+		name      string
+		entry     *MempoolEntry
+		pkg       FeeRate
+		effective FeeRate
+	}{
+		// The child lifts its parent from 500 to 5000 per 1000 bytes, and
+		// the grandchild pays for both at a lower rate.
+		{"parent", parent, 500, 5000},
+		{"child", child, 5000, 5000},
+		{"grandchild", grandchild, 4333, 4333},
+		{"sibling", sibling, 300, 300},
+	}
+
+	for _, test := range tests {
+		if rate := pool.PackageFeeRate(test.entry); rate != test.pkg {
+			t.Errorf("%s: package rate = %d, want %d", test.name, rate, test.pkg)
+		}
+		if rate := pool.EffectiveFeeRate(test.entry); rate != test.effective {
+			t.Errorf("%s: effective rate = %d, want %d", test.name, rate, test.effective)
+		}
+	}
+}
+
+func TestChildPaysForParent(t *testing.T) {
+	const parentRate FeeRate = 2000
+
+	for _, rate := range []FeeRate{1500, 4000, 10000, 50000} {
+		chain := testChain(t, testAddress(1))
+		pool, err := NewMempool(chain, DefaultPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walletDB, _ := wallet.CreateWalletDB()
+		address := walletDB.AddWallet(wallet.P256)
+		walletDB.SaveFile()
+		if _, err := pool.Mine(address); err != nil {
+			t.Fatal(err)
+		}
+
+		tx := NewTransaction(address, testAddress(3), Coin, pool, SendOptions{FeeRate: parentRate, Replaceable: true})
+		parent, err := pool.Add(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		childTx, err := pool.NewChildPaysForParent(tx.Id, rate)
+		if err != nil {
+			t.Fatalf("rate %s: %v", rate, err)
+		}
+		child, err := pool.Add(childTx)
+		if err != nil {
+			t.Fatalf("rate %s: %v", rate, err)
+		}
+
+		// Below the rate of the parent the child pays the rate alone. The
+		// fee is reckoned for an uncompressed key, so it pays a little more.
+		got := pool.PackageFeeRate(child)
+		if rate < parentRate {
+			got = child.FeeRate()
+		}
+		if got < rate || got > rate+rate/4 {
+			t.Errorf("rate %s: package pays %s", rate, got)
+		}
+		if rate > parentRate && pool.EffectiveFeeRate(parent) < rate {
+			t.Errorf("rate %s: parent is mined at %s", rate, pool.EffectiveFeeRate(parent))
+		}
+	}
+}
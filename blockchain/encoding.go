@@ -0,0 +1,405 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/goozt/seashell/internal/codec"
+)
+
+// Blocks and transactions are stored in a fixed binary layout. Integers are
+// big-endian and every byte string or list carries a uint32 length prefix.
+//
+//	transaction: version uint32
+//	             input count, each: id bytes, out int32, script bytes, sequence uint32
+//	             output count, each: value int64, script bytes
+//	             locktime uint32
+//	             version 2 only, for each input: witness item count, each: item bytes
+//	block:       version uint32, timestamp uint64, height int64, nonce int64,
+//	             prev hash bytes, hash bytes, transaction count, each: transaction bytes
+//	pool entry:  version uint32, transaction bytes, fee uint64, time int64, height int64
+//	orphan:      version uint32, transaction bytes, time int64, parent count, each: id bytes
+//	estimates:   version uint32, height int64, bucket count, each: total float64,
+//	             rate sum float64, target count, each: confirmed float64
+//	minimum fee: version uint32, rate uint64, time int64
+//	raw tx:      version uint32, transaction bytes,
+//	             spent output count, each: value int64, script bytes
+//	multisig tx: version uint32, transaction bytes,
+//	             spent output count, each: value int64, script bytes,
+//	             redeem script bytes, for each input: signature count,
+//	             each: public key bytes, signature bytes
+//
+// Output values are base units. Version 1 blocks, which stored whole coins,
+// are no longer read.
+//
+// Transactions with witnesses use version 2, all others version 1.
+// Transaction ids are the sha256 of the version 1 encoding, which leaves the
+// witnesses out, and witness hashes the sha256 of the full encoding.
+const (
+	txVersion           = 1
+	txWitnessVersion    = 2
+	blockVersion        = 2
+	poolEntryVersion    = 1
+	orphanVersion       = 1
+	feeEstimatesVersion = 1
+	minFeeVersion       = 1
+	rawTxVersion        = 1
+	partialTxVersion    = 1
+)
+
+type encoder struct {
+	codec.Encoder
+}
+
+type decoder struct {
+	*codec.Decoder
+}
+
+func newDecoder(data []byte) decoder {
+	return decoder{codec.NewDecoder(data)}
+}
+
+func (e *encoder) putTransaction(tx *Transaction, withWitness bool) {
+	withWitness = withWitness && tx.HasWitness()
+
+	if withWitness {
+		e.PutUint32(txWitnessVersion)
+	} else {
+		e.PutUint32(txVersion)
+	}
+
+	e.PutUint32(uint32(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		e.PutBytes(in.Id)
+		e.PutUint32(uint32(int32(in.Out)))
+		e.PutBytes(in.Script)
+		e.PutUint32(in.Sequence)
+	}
+
+	e.PutUint32(uint32(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		e.PutUint64(uint64(out.Value))
+		e.PutBytes(out.Script)
+	}
+
+	e.PutUint32(tx.LockTime)
+
+	if !withWitness {
+		return
+	}
+	for _, in := range tx.Inputs {
+		e.PutUint32(uint32(len(in.Witness)))
+		for _, item := range in.Witness {
+			e.PutBytes(item)
+		}
+	}
+}
+
+func (d *decoder) transaction() *Transaction {
+	var tx Transaction
+
+	version := d.Version("transaction", txVersion, txWitnessVersion)
+
+	for i, n := 0, d.Count("input"); i < n && d.Err == nil; i++ {
+		var in TxInput
+		in.Id = d.Bytes("input id")
+		in.Out = int(int32(d.Uint32("input index")))
+		in.Script = d.Bytes("input script")
+		in.Sequence = d.Uint32("input sequence")
+		tx.Inputs = append(tx.Inputs, in)
+	}
+
+	for i, n := 0, d.Count("output"); i < n && d.Err == nil; i++ {
+		var out TxOutput
+		out.Value = Amount(d.Uint64("output value"))
+		out.Script = d.Bytes("output script")
+		tx.Outputs = append(tx.Outputs, out)
+	}
+
+	tx.LockTime = d.Uint32("locktime")
+
+	if version != txWitnessVersion {
+		return &tx
+	}
+	for i := range tx.Inputs {
+		for j, n := 0, d.Count("witness item"); j < n && d.Err == nil; j++ {
+			tx.Inputs[i].Witness = append(tx.Inputs[i].Witness, d.Bytes("witness item"))
+		}
+	}
+	if d.Err == nil && !tx.HasWitness() {
+		d.Err = fmt.Errorf("version %d transaction without witnesses", txWitnessVersion)
+	}
+
+	return &tx
+}
+
+func (e *encoder) putBlock(b *Block) {
+	e.PutUint32(blockVersion)
+	e.PutUint64(uint64(b.Timestamp))
+	e.PutUint64(uint64(int64(b.Height)))
+	e.PutUint64(uint64(int64(b.Nonce)))
+	e.PutBytes(b.PrevHash)
+	e.PutBytes(b.Hash)
+
+	e.PutUint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		e.PutBytes(tx.Serialize())
+	}
+}
+
+func (d *decoder) block() *Block {
+	var b Block
+
+	d.Version("block", blockVersion)
+	b.Timestamp = uint(d.Uint64("timestamp"))
+	b.Height = int(int64(d.Uint64("height")))
+	b.Nonce = int(int64(d.Uint64("nonce")))
+	b.PrevHash = d.Bytes("previous hash")
+	b.Hash = d.Bytes("block hash")
+
+	for i, n := 0, d.Count("transaction"); i < n && d.Err == nil; i++ {
+		tx, err := DeserializeTransaction(d.Bytes("transaction"))
+		if err != nil && d.Err == nil {
+			d.Err = fmt.Errorf("transaction %d: %v", i, err)
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+
+	return &b
+}
+
+func (e *encoder) putPoolEntry(entry *MempoolEntry) {
+	e.PutUint32(poolEntryVersion)
+	e.PutBytes(entry.Tx.Serialize())
+	e.PutUint64(uint64(entry.Fee))
+	e.PutUint64(uint64(entry.Time))
+	e.PutUint64(uint64(int64(entry.Height)))
+}
+
+func (d *decoder) poolEntry() *MempoolEntry {
+	var entry MempoolEntry
+
+	d.Version("pool entry", poolEntryVersion)
+	data := d.Bytes("transaction")
+	entry.Fee = Amount(d.Uint64("fee"))
+	entry.Time = int64(d.Uint64("time"))
+	entry.Height = int(int64(d.Uint64("height")))
+
+	if d.Err == nil {
+		entry.Tx, d.Err = DeserializeTransaction(data)
+	}
+	if d.Err == nil {
+		entry.Size = entry.Tx.Size()
+	}
+
+	return &entry
+}
+
+func (e *encoder) putRawTransaction(rt *RawTransaction) {
+	e.PutUint32(rawTxVersion)
+	e.PutBytes(rt.Tx.Serialize())
+
+	e.PutUint32(uint32(len(rt.PrevOutputs)))
+	for _, out := range rt.PrevOutputs {
+		e.PutUint64(uint64(out.Value))
+		e.PutBytes(out.Script)
+	}
+}
+
+func (d *decoder) rawTransaction() *RawTransaction {
+	var rt RawTransaction
+
+	d.Version("raw transaction", rawTxVersion)
+	data := d.Bytes("transaction")
+
+	for i, n := 0, d.Count("spent output"); i < n && d.Err == nil; i++ {
+		var out TxOutput
+		out.Value = Amount(d.Uint64("spent output value"))
+		out.Script = d.Bytes("spent output script")
+		rt.PrevOutputs = append(rt.PrevOutputs, out)
+	}
+
+	if d.Err == nil {
+		var tx *Transaction
+		tx, d.Err = DeserializeTransaction(data)
+		if d.Err == nil {
+			rt.Tx = *tx
+		}
+	}
+	if d.Err == nil && len(rt.PrevOutputs) != len(rt.Tx.Inputs) {
+		d.Err = fmt.Errorf("%d spent outputs for %d inputs", len(rt.PrevOutputs), len(rt.Tx.Inputs))
+	}
+
+	return &rt
+}
+
+func (e *encoder) putPartialTransaction(pt *PartialTransaction) {
+	e.PutUint32(partialTxVersion)
+	e.PutBytes(pt.Tx.Serialize())
+
+	e.PutUint32(uint32(len(pt.PrevOutputs)))
+	for _, out := range pt.PrevOutputs {
+		e.PutUint64(uint64(out.Value))
+		e.PutBytes(out.Script)
+	}
+
+	e.PutBytes(pt.RedeemScript)
+
+	for _, signatures := range pt.Signatures {
+		var pubKeys []string
+		for pubKey := range signatures {
+			pubKeys = append(pubKeys, pubKey)
+		}
+		sort.Strings(pubKeys)
+
+		e.PutUint32(uint32(len(pubKeys)))
+		for _, pubKey := range pubKeys {
+			key, _ := hex.DecodeString(pubKey)
+			e.PutBytes(key)
+			e.PutBytes(signatures[pubKey])
+		}
+	}
+}
+
+func (d *decoder) partialTransaction() *PartialTransaction {
+	var pt PartialTransaction
+
+	d.Version("multisig transaction", partialTxVersion)
+	data := d.Bytes("transaction")
+
+	for i, n := 0, d.Count("spent output"); i < n && d.Err == nil; i++ {
+		var out TxOutput
+		out.Value = Amount(d.Uint64("spent output value"))
+		out.Script = d.Bytes("spent output script")
+		pt.PrevOutputs = append(pt.PrevOutputs, out)
+	}
+
+	pt.RedeemScript = d.Bytes("redeem script")
+
+	if d.Err == nil {
+		var tx *Transaction
+		tx, d.Err = DeserializeTransaction(data)
+		if d.Err == nil {
+			pt.Tx = *tx
+		}
+	}
+	if d.Err == nil && len(pt.PrevOutputs) != len(pt.Tx.Inputs) {
+		d.Err = fmt.Errorf("%d spent outputs for %d inputs", len(pt.PrevOutputs), len(pt.Tx.Inputs))
+	}
+
+	for range pt.Tx.Inputs {
+		signatures := make(map[string][]byte)
+		for i, n := 0, d.Count("signature"); i < n && d.Err == nil; i++ {
+			pubKey := d.Bytes("public key")
+			signatures[hex.EncodeToString(pubKey)] = d.Bytes("signature")
+		}
+		pt.Signatures = append(pt.Signatures, signatures)
+	}
+
+	return &pt
+}
+
+func (e *encoder) putOrphanTransaction(o *orphan) {
+	e.PutUint32(orphanVersion)
+	e.PutBytes(o.value.(*Transaction).Serialize())
+	e.PutUint64(uint64(o.time))
+
+	e.PutUint32(uint32(len(o.parents)))
+	for _, parent := range o.parents {
+		id, _ := hex.DecodeString(parent)
+		e.PutBytes(id)
+	}
+}
+
+func (d *decoder) orphanTransaction() *orphan {
+	var o orphan
+
+	d.Version("orphan", orphanVersion)
+	data := d.Bytes("transaction")
+	o.time = int64(d.Uint64("time"))
+
+	for i, n := 0, d.Count("parent"); i < n && d.Err == nil; i++ {
+		o.parents = append(o.parents, hex.EncodeToString(d.Bytes("parent id")))
+	}
+
+	if d.Err == nil {
+		var tx *Transaction
+		tx, d.Err = DeserializeTransaction(data)
+		if d.Err == nil {
+			o.id = hex.EncodeToString(tx.Id)
+			o.value = tx
+		}
+	}
+
+	return &o
+}
+
+func (e *encoder) putFloat64(v float64) {
+	e.PutUint64(math.Float64bits(v))
+}
+
+func (d *decoder) float64(what string) float64 {
+	return math.Float64frombits(d.Uint64(what))
+}
+
+func (e *encoder) putMinFee(rate FeeRate, time int64) {
+	e.PutUint32(minFeeVersion)
+	e.PutUint64(uint64(rate))
+	e.PutUint64(uint64(time))
+}
+
+func (d *decoder) minFee() (FeeRate, int64) {
+	d.Version("minimum fee", minFeeVersion)
+	rate := FeeRate(d.Uint64("rate"))
+	time := int64(d.Uint64("time"))
+
+	return rate, time
+}
+
+func (e *encoder) putFeeEstimator(est *feeEstimator) {
+	e.PutUint32(feeEstimatesVersion)
+	e.PutUint64(uint64(int64(est.height)))
+
+	e.PutUint32(uint32(len(est.total)))
+	for b := range est.total {
+		e.putFloat64(est.total[b])
+		e.putFloat64(est.rateSum[b])
+		e.PutUint32(uint32(len(est.confirmed[b])))
+		for _, confirmed := range est.confirmed[b] {
+			e.putFloat64(confirmed)
+		}
+	}
+}
+
+// feeEstimator returns nil for estimates counted in other buckets or
+// targets than the current ones, which are started over.
+func (d *decoder) feeEstimator() *feeEstimator {
+	est := newFeeEstimator()
+
+	d.Version("fee estimates", feeEstimatesVersion)
+	est.height = int(int64(d.Uint64("height")))
+
+	buckets := d.Count("bucket")
+	compatible := buckets == len(feeBuckets)
+	for b := 0; b < buckets && d.Err == nil; b++ {
+		total, rateSum := d.float64("total"), d.float64("rate sum")
+		targets := d.Count("target")
+		compatible = compatible && targets == MaxConfirmTarget
+		for t := 0; t < targets && d.Err == nil; t++ {
+			confirmed := d.float64("confirmed")
+			if compatible {
+				est.confirmed[b][t] = confirmed
+			}
+		}
+		if compatible {
+			est.total[b], est.rateSum[b] = total, rateSum
+		}
+	}
+
+	if !compatible {
+		return nil
+	}
+	return est
+}
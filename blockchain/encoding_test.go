@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+func testAddress(b byte) string {
+	return string(wallet.AddressFromPubKeyHash(bytes.Repeat([]byte{b}, 20)))
+}
+
+func testBlock() *Block {
+	coinbase := CoinbaseTx(testAddress(1), "")
+
+	spend := &Transaction{
+		Inputs: []TxInput{{
+			Id:       coinbase.Id,
+			Out:      0,
+			Sequence: MaxSequence,
+			Witness:  [][]byte{bytes.Repeat([]byte{2}, 64), bytes.Repeat([]byte{3}, 33)},
+		}},
+		Outputs:  []TxOutput{*NewTxOutput(Coin, testAddress(4))},
+		LockTime: 7,
+	}
+	spend.SetID()
+
+	return &Block{
+		Timestamp:    1700000000,
+		PrevHash:     bytes.Repeat([]byte{5}, 32),
+		Transactions: []*Transaction{coinbase, spend},
+		Hash:         bytes.Repeat([]byte{6}, 32),
+		Nonce:        42,
+		Height:       3,
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	block := testBlock()
+
+	decoded, err := Deserialize(block.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Serialize(), block.Serialize()) {
+		t.Fatal("block changed in a round trip")
+	}
+	for i, tx := range decoded.Transactions {
+		if !bytes.Equal(tx.Id, block.Transactions[i].Id) {
+			t.Errorf("transaction %d id = %x, want %x", i, tx.Id, block.Transactions[i].Id)
+		}
+		if !bytes.Equal(tx.WitnessHash(), block.Transactions[i].WitnessHash()) {
+			t.Errorf("transaction %d witness hash changed", i)
+		}
+	}
+}
+
+func TestDeserializeRejectsOldEncodings(t *testing.T) {
+	data := testBlock().Serialize()
+
+	versionOne := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(versionOne, 1)
+	if _, err := Deserialize(versionOne); err == nil {
+		t.Error("version 1 block was accepted")
+	}
+
+	// gob streams start with a non-zero length byte.
+	if _, err := Deserialize(append([]byte{0x3f}, data[1:]...)); err == nil {
+		t.Error("gob block was accepted")
+	}
+
+	if _, err := Deserialize(append(data, 0)); err == nil {
+		t.Error("block with trailing bytes was accepted")
+	}
+}
+
+func TestTransactionIdLeavesOutWitness(t *testing.T) {
+	tx := testBlock().Transactions[1]
+	id := tx.Hash()
+
+	tx.Inputs[0].Witness[0] = bytes.Repeat([]byte{9}, 64)
+	if !bytes.Equal(tx.Hash(), id) {
+		t.Error("changing a witness changed the transaction id")
+	}
+}
+
+func TestRawTransactionRoundTrip(t *testing.T) {
+	block := testBlock()
+	rt := &RawTransaction{Tx: *block.Transactions[1], PrevOutputs: block.Transactions[0].Outputs}
+
+	decoded, err := DeserializeRawTransaction(rt.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Serialize(), rt.Serialize()) {
+		t.Fatal("raw transaction changed in a round trip")
+	}
+	if fee, err := decoded.Fee(); err != nil || fee != Subsidy-Coin {
+		t.Errorf("fee = %s, %v, want %s", fee, err, Subsidy-Coin)
+	}
+
+	rt.PrevOutputs = nil
+	if _, err := DeserializeRawTransaction(rt.Serialize()); err == nil {
+		t.Error("raw transaction without its spent outputs was accepted")
+	}
+}
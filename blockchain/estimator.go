@@ -0,0 +1,197 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+const (
+	MaxConfirmTarget     = 25
+	DefaultConfirmTarget = 6
+	// FallbackFeeRate is paid when too few transactions confirmed recently
+	// to estimate a fee rate.
+	FallbackFeeRate FeeRate = 20000
+
+	// Samples lose this much weight with every block, so estimates follow
+	// the recent blocks.
+	feeEstimateDecay = 0.95
+	// A fee rate is estimated to confirm within a target when this share of
+	// the transactions paying it did.
+	feeEstimateSuccess    = 0.85
+	feeEstimateMinSamples = 1.0
+	minBucketFeeRate      = 1000
+	maxBucketFeeRate      = 1e10
+	feeBucketSpacing      = 1.25
+)
+
+var feeEstimatesKey = []byte("fee-estimates")
+
+// feeBuckets are the lower bounds of the fee rate ranges confirmations are
+// counted in.
+var feeBuckets = func() []FeeRate {
+	buckets := []FeeRate{0}
+	for rate := float64(minBucketFeeRate); rate < maxBucketFeeRate; rate *= feeBucketSpacing {
+		buckets = append(buckets, FeeRate(rate))
+	}
+	return buckets
+}()
+
+// feeEstimator counts, per fee rate bucket, how many pool transactions were
+// mined and how many of them within each number of blocks up to
+// MaxConfirmTarget.
+type feeEstimator struct {
+	height    int
+	total     []float64
+	rateSum   []float64
+	confirmed [][]float64
+}
+
+func newFeeEstimator() *feeEstimator {
+	est := &feeEstimator{
+		total:     make([]float64, len(feeBuckets)),
+		rateSum:   make([]float64, len(feeBuckets)),
+		confirmed: make([][]float64, len(feeBuckets)),
+	}
+	for b := range est.confirmed {
+		est.confirmed[b] = make([]float64, MaxConfirmTarget)
+	}
+
+	return est
+}
+
+func feeBucket(rate FeeRate) int {
+	b := len(feeBuckets) - 1
+	for b > 0 && rate < feeBuckets[b] {
+		b--
+	}
+
+	return b
+}
+
+// advance decays the counts up to the block at height.
+func (est *feeEstimator) advance(height int) {
+	if height <= est.height {
+		return
+	}
+
+	decay := math.Pow(feeEstimateDecay, float64(height-est.height))
+	for b := range feeBuckets {
+		est.total[b] *= decay
+		est.rateSum[b] *= decay
+		for t := range est.confirmed[b] {
+			est.confirmed[b][t] *= decay
+		}
+	}
+	est.height = height
+}
+
+// record counts entry as mined in the block at height.
+func (est *feeEstimator) record(entry *MempoolEntry, height int) {
+	blocks := height - entry.Height
+	if blocks < 1 {
+		return
+	}
+
+	b := feeBucket(entry.FeeRate())
+	est.total[b]++
+	est.rateSum[b] += float64(entry.FeeRate())
+	for t := blocks; t <= MaxConfirmTarget; t++ {
+		est.confirmed[b][t-1]++
+	}
+}
+
+// estimate groups buckets from the highest rate down until each group has
+// enough samples, and returns the average rate of the lowest group in which
+// enough transactions confirmed within target blocks. Transactions still
+// waiting after target blocks count as failed.
+func (est *feeEstimator) estimate(target int, waiting []float64) (FeeRate, bool) {
+	var confirmed, total, mined, rateSum float64
+	var estimate FeeRate
+	found := false
+
+	for b := len(feeBuckets) - 1; b >= 0; b-- {
+		confirmed += est.confirmed[b][target-1]
+		total += est.total[b] + waiting[b]
+		mined += est.total[b]
+		rateSum += est.rateSum[b]
+
+		if total < feeEstimateMinSamples {
+			continue
+		}
+		if confirmed/total < feeEstimateSuccess {
+			break
+		}
+
+		estimate, found = FeeRate(math.Ceil(rateSum/mined)), true
+		confirmed, total, mined, rateSum = 0, 0, 0, 0
+	}
+
+	return estimate, found
+}
+
+// EstimateFee returns the fee rate expected to get a transaction mined
+// within targetBlocks, judged by how long the recent blocks took to mine
+// pool transactions and by those still waiting. It is never below the
+// minimum fee rate of the pool.
+func (pool *Mempool) EstimateFee(targetBlocks int) (FeeRate, error) {
+	if targetBlocks < 1 || targetBlocks > MaxConfirmTarget {
+		return 0, fmt.Errorf("target of %d blocks is not between 1 and %d", targetBlocks, MaxConfirmTarget)
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	waiting := make([]float64, len(feeBuckets))
+	height := pool.chain.Height()
+	for _, entry := range pool.entries {
+		if height-entry.Height >= targetBlocks {
+			waiting[feeBucket(entry.FeeRate())]++
+		}
+	}
+
+	rate, ok := pool.fees.estimate(targetBlocks, waiting)
+	if !ok {
+		return 0, fmt.Errorf("too few transactions were mined recently to estimate a fee rate for %d blocks", targetBlocks)
+	}
+	if min := pool.minFee(time.Now().Unix()); rate < min {
+		rate = min
+	}
+
+	return rate, nil
+}
+
+func (pool *Mempool) loadFeeEstimates(txn *badger.Txn) error {
+	item, err := txn.Get(feeEstimatesKey)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	d := newDecoder(data)
+	est := d.feeEstimator()
+	if err := d.Finish("fee estimates"); err != nil {
+		return fmt.Errorf("invalid fee estimates: %v", err)
+	}
+	if est != nil {
+		pool.fees = est
+	}
+
+	return nil
+}
+
+func (pool *Mempool) saveFeeEstimates() error {
+	return pool.chain.Database.Update(func(txn *badger.Txn) error {
+		var e encoder
+		e.putFeeEstimator(pool.fees)
+		return txn.Set(feeEstimatesKey, e.Bytes())
+	})
+}
@@ -0,0 +1,75 @@
+package blockchain
+
+import "testing"
+
+// testFeeEstimator counts, at height 100, 20 transactions mined within 1
+// block at 50000 per 1000 bytes, 20 within 3 blocks at 10000 and 20 within
+// 10 blocks at 2000.
+func testFeeEstimator() *feeEstimator {
+	const height = 100
+
+	est := newFeeEstimator()
+	est.advance(height)
+	for _, sample := range []struct {
+		rate   Amount
+		blocks int
+	}{{50000, 1}, {10000, 3}, {2000, 10}} {
+		for i := 0; i < 20; i++ {
+			entry := &MempoolEntry{Fee: sample.rate, Size: 1000, Height: height - sample.blocks}
+			est.record(entry, height)
+		}
+	}
+
+	return est
+}
+
+func TestFeeEstimates(t *testing.T) {
+	waitingAt := func(rate FeeRate, n float64) []float64 {
+		waiting := make([]float64, len(feeBuckets))
+		waiting[feeBucket(rate)] = n
+		return waiting
+	}
+	none := make([]float64, len(feeBuckets))
+
+	tests := []struct {
+		name    string
+		target  int
+		waiting []float64
+		decay   int
+		want    FeeRate
+		found   bool
+	}{
+		{"next block", 1, none, 0, 50000, true},
+		{"two blocks", 2, none, 0, 50000, true},
+		{"three blocks", 3, none, 0, 10000, true},
+		{"ten blocks", 10, none, 0, 2000, true},
+		{"longest target", MaxConfirmTarget, none, 0, 2000, true},
+		// Waiting transactions count as failures at their rate.
+		{"three blocks, many waiting", 3, waitingAt(10000, 20), 0, 50000, true},
+		{"three blocks, few waiting", 3, waitingAt(10000, 2), 0, 10000, true},
+		{"ten blocks, waiting at a low rate", 10, waitingAt(1000, 20), 0, 2000, true},
+		// Old samples fade until there are too few to estimate.
+		{"recent blocks", 3, none, 10, 10000, true},
+		{"old blocks", 3, none, 100, 0, false},
+	}
+
+	for _, test := range tests {
+		est := testFeeEstimator()
+		est.advance(est.height + test.decay)
+
+		rate, found := est.estimate(test.target, test.waiting)
+		if found != test.found || rate != test.want {
+			t.Errorf("%s: estimate = %s, %t, want %s, %t", test.name, rate, found, test.want, test.found)
+		}
+	}
+}
+
+func TestEstimateFeeTargets(t *testing.T) {
+	pool := testMempool(DefaultPolicy.MaxMempoolSize)
+
+	for _, target := range []int{0, -1, MaxConfirmTarget + 1} {
+		if _, err := pool.EstimateFee(target); err == nil {
+			t.Errorf("target of %d blocks was estimated", target)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+const HTLCSecretSize = 32
+
+type HTLC struct {
+	Hash         []byte
+	RecipientPKH []byte
+	RefundPKH    []byte
+	Timeout      uint32
+}
+
+// Script locks an output to RecipientPKH for whoever reveals the preimage
+// of Hash, or back to RefundPKH once Timeout has passed.
+func (h HTLC) Script() Script {
+	return NewScriptBuilder().
+		AddOp(OP_IF).
+		AddOp(OP_SIZE).AddInt64(HTLCSecretSize).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_SHA256).AddData(h.Hash).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.RecipientPKH).
+		AddOp(OP_ELSE).
+		AddInt64(int64(h.Timeout)).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.RefundPKH).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG).
+		Script()
+}
+
+func ParseHTLCScript(script Script) (*HTLC, error) {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) != 20 {
+		return nil, fmt.Errorf("script is not an HTLC")
+	}
+
+	timeout, err := scriptNum(ops[11], maxLockTimeNumLength)
+	if err != nil || timeout < 0 || timeout > MaxSequence {
+		return nil, fmt.Errorf("script is not an HTLC")
+	}
+
+	htlc := &HTLC{ops[5].Data, ops[9].Data, ops[16].Data, uint32(timeout)}
+	if !bytes.Equal(htlc.Script(), script) {
+		return nil, fmt.Errorf("script is not an HTLC")
+	}
+
+	return htlc, nil
+}
+
+func NewHTLCClaimTransaction(prevTx *Transaction, out int, preimage []byte, w *wallet.Wallet, rate FeeRate) (*Transaction, error) {
+	htlc, err := htlcOutput(prevTx, out)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(preimage)
+	if len(preimage) != HTLCSecretSize || !bytes.Equal(hash[:], htlc.Hash) {
+		return nil, fmt.Errorf("preimage does not match the HTLC hash %x", htlc.Hash)
+	}
+	if !bytes.Equal(wallet.PublicKeyHash(w.PublicKey), htlc.RecipientPKH) {
+		return nil, fmt.Errorf("wallet is not the HTLC recipient")
+	}
+
+	return htlcSpend(prevTx, out, w, 0, MaxSequence, rate, func(signature []byte) [][]byte {
+		return [][]byte{signature, w.PublicKey, preimage, {1}}
+	})
+}
+
+func NewHTLCRefundTransaction(prevTx *Transaction, out int, w *wallet.Wallet, rate FeeRate) (*Transaction, error) {
+	htlc, err := htlcOutput(prevTx, out)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(wallet.PublicKeyHash(w.PublicKey), htlc.RefundPKH) {
+		return nil, fmt.Errorf("wallet is not the HTLC refund address")
+	}
+
+	return htlcSpend(prevTx, out, w, htlc.Timeout, MaxSequence-1, rate, func(signature []byte) [][]byte {
+		return [][]byte{signature, w.PublicKey, {}}
+	})
+}
+
+func htlcOutput(prevTx *Transaction, out int) (*HTLC, error) {
+	if out < 0 || out >= len(prevTx.Outputs) {
+		return nil, fmt.Errorf("transaction %x has no output %d", prevTx.Id, out)
+	}
+
+	return ParseHTLCScript(prevTx.Outputs[out].Script)
+}
+
+// htlcSpend pays the HTLC output to w less the fee at rate, and signs it
+// with the witness that witness builds around the signature.
+func htlcSpend(prevTx *Transaction, out int, w *wallet.Wallet, lockTime, sequence uint32, rate FeeRate, witness func(signature []byte) [][]byte) (*Transaction, error) {
+	value := prevTx.Outputs[out].Value
+	input := TxInput{prevTx.Id, out, nil, sequence, nil}
+	output := NewTxOutput(value, string(w.Address()))
+
+	tx := Transaction{nil, []TxInput{input}, []TxOutput{*output}, lockTime}
+	tx.Inputs[0].Witness = witness(make([]byte, 72))
+	fee := rate.Fee(tx.Size())
+	if fee >= value {
+		return nil, fmt.Errorf("HTLC output of %s does not cover the fee of %s", value, fee)
+	}
+
+	tx.Outputs[0].Value = value - fee
+	tx.Inputs[0].Witness = nil
+	tx.SetID()
+	tx.Inputs[0].Witness = witness(w.Sign(tx.SignatureHash(0, prevTx.Outputs[out])))
+
+	return &tx, nil
+}
+
+func scriptNum(op ScriptOp, maxLength int) (int64, error) {
+	if n, ok := smallInt(op); ok {
+		return int64(n), nil
+	}
+	if op.Opcode == OP_0 {
+		return 0, nil
+	}
+
+	return DecodeScriptNum(op.Data, maxLength)
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+func TestHTLCSpends(t *testing.T) {
+	const timeout = 100
+	const rate FeeRate = 1000
+
+	recipient := wallet.NewWallet(wallet.P256)
+	sender := wallet.NewWallet(wallet.Ed25519)
+	secret := make([]byte, HTLCSecretSize)
+	secret[0] = 1
+	shortSecret := []byte("short")
+
+	htlcTx := func(preimage []byte) *Transaction {
+		hash := sha256.Sum256(preimage)
+		htlc := HTLC{hash[:], wallet.PublicKeyHash(recipient.PublicKey), wallet.PublicKeyHash(sender.PublicKey), timeout}
+		prevTx := &Transaction{Outputs: []TxOutput{{Value: 10 * Coin, Script: htlc.Script()}}}
+		prevTx.SetID()
+		return prevTx
+	}
+	prevTx := htlcTx(secret)
+
+	tests := []struct {
+		name   string
+		prevTx *Transaction
+		spend  func(prevTx *Transaction) (*Transaction, error)
+		ok     bool
+	}{
+		{"claim", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return NewHTLCClaimTransaction(prevTx, 0, secret, recipient, rate)
+		}, true},
+		{"claim with the wrong preimage", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return NewHTLCClaimTransaction(prevTx, 0, make([]byte, HTLCSecretSize), recipient, rate)
+		}, false},
+		{"claim by the sender", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return NewHTLCClaimTransaction(prevTx, 0, secret, sender, rate)
+		}, false},
+		{"claim forged by the sender", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return htlcSpend(prevTx, 0, sender, 0, MaxSequence, rate, func(signature []byte) [][]byte {
+				return [][]byte{signature, sender.PublicKey, secret, {1}}
+			})
+		}, false},
+		{"claim with a short preimage", htlcTx(shortSecret), func(prevTx *Transaction) (*Transaction, error) {
+			return htlcSpend(prevTx, 0, recipient, 0, MaxSequence, rate, func(signature []byte) [][]byte {
+				return [][]byte{signature, recipient.PublicKey, shortSecret, {1}}
+			})
+		}, false},
+		{"refund", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return NewHTLCRefundTransaction(prevTx, 0, sender, rate)
+		}, true},
+		{"refund by the recipient", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return NewHTLCRefundTransaction(prevTx, 0, recipient, rate)
+		}, false},
+		{"refund before the timeout", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return htlcSpend(prevTx, 0, sender, timeout-1, MaxSequence-1, rate, func(signature []byte) [][]byte {
+				return [][]byte{signature, sender.PublicKey, {}}
+			})
+		}, false},
+		{"refund with a final input", prevTx, func(prevTx *Transaction) (*Transaction, error) {
+			return htlcSpend(prevTx, 0, sender, timeout, MaxSequence, rate, func(signature []byte) [][]byte {
+				return [][]byte{signature, sender.PublicKey, {}}
+			})
+		}, false},
+	}
+
+	for _, test := range tests {
+		tx, err := test.spend(test.prevTx)
+		if err == nil {
+			err = tx.VerifyInput(0, test.prevTx.Outputs[0])
+		}
+
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: spend was accepted", test.name)
+		}
+	}
+}
+
+func TestHTLCRefundLockTime(t *testing.T) {
+	sender := wallet.NewWallet(wallet.P256)
+	htlc := HTLC{make([]byte, 32), bytes.Repeat([]byte{1}, publicKeyHashLength), wallet.PublicKeyHash(sender.PublicKey), 100}
+	prevTx := &Transaction{Outputs: []TxOutput{{Value: Coin, Script: htlc.Script()}}}
+	prevTx.SetID()
+
+	tx, err := NewHTLCRefundTransaction(prevTx, 0, sender, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The refund can be mined only in a block after the timeout height.
+	if tx.IsFinal(100, 0) {
+		t.Error("refund is final at the timeout height")
+	}
+	if !tx.IsFinal(101, 0) {
+		t.Error("refund is not final after the timeout height")
+	}
+}
+
+func TestParseHTLCScript(t *testing.T) {
+	htlc := HTLC{make([]byte, 32), bytes.Repeat([]byte{1}, publicKeyHashLength), bytes.Repeat([]byte{2}, publicKeyHashLength), 1234}
+
+	parsed, err := ParseHTLCScript(htlc.Script())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Timeout != htlc.Timeout || !bytes.Equal(parsed.RefundPKH, htlc.RefundPKH) {
+		t.Errorf("parsed %+v, want %+v", parsed, htlc)
+	}
+
+	if _, err := ParseHTLCScript(P2PKHScript(bytes.Repeat([]byte{1}, publicKeyHashLength))); err == nil {
+		t.Error("P2PKH script parsed as an HTLC")
+	}
+}
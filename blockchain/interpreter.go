@@ -0,0 +1,467 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// SignatureChecker verifies signatures and timelocks from a script against
+// the transaction input that is being unlocked.
+type SignatureChecker interface {
+	CheckSignature(signature, pubKey []byte) bool
+	CheckLockTime(lockTime int64) bool
+	CheckSequence(sequence int64) bool
+}
+
+type Engine struct {
+	stack     [][]byte
+	condStack []bool
+	checker   SignatureChecker
+	opCount   int
+}
+
+func NewEngine(checker SignatureChecker) *Engine {
+	return &Engine{checker: checker}
+}
+
+// ExecuteWitness runs lock on a stack made of the witness items, the first
+// item at the bottom, as though they had been pushed by an unlocking script.
+func ExecuteWitness(witness [][]byte, lock Script, checker SignatureChecker) error {
+	if len(witness) > MaxStackSize {
+		return fmt.Errorf("witness of %d items exceeds the stack size %d", len(witness), MaxStackSize)
+	}
+	for i, item := range witness {
+		if len(item) > MaxScriptElement {
+			return fmt.Errorf("witness item %d of %d bytes exceeds %d", i, len(item), MaxScriptElement)
+		}
+	}
+
+	engine := NewEngine(checker)
+	engine.stack = append([][]byte{}, witness...)
+
+	return executeLock(engine, lock)
+}
+
+func executeLock(engine *Engine, lock Script) error {
+	unlockStack := append([][]byte{}, engine.stack...)
+
+	if err := engine.Execute(lock); err != nil {
+		return err
+	}
+	if err := engine.CheckSuccess(); err != nil {
+		return err
+	}
+
+	if !lock.IsP2SH() {
+		return nil
+	}
+
+	engine.stack = unlockStack
+	redeemScript, err := engine.pop()
+	if err != nil {
+		return err
+	}
+	if err := engine.Execute(redeemScript); err != nil {
+		return fmt.Errorf("redeem script: %v", err)
+	}
+
+	return engine.CheckSuccess()
+}
+
+func (e *Engine) CheckSuccess() error {
+	if len(e.stack) == 0 {
+		return fmt.Errorf("script finished with an empty stack")
+	}
+	if !castToBool(e.stack[len(e.stack)-1]) {
+		return fmt.Errorf("script finished with false on the stack")
+	}
+
+	return nil
+}
+
+func (e *Engine) executing() bool {
+	for _, cond := range e.condStack {
+		if !cond {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) Execute(script Script) error {
+	if len(script) > MaxScriptSize {
+		return fmt.Errorf("script of %d bytes exceeds %d", len(script), MaxScriptSize)
+	}
+
+	ops, err := ParseScript(script)
+	if err != nil {
+		return err
+	}
+
+	e.condStack = nil
+	e.opCount = 0
+
+	for _, op := range ops {
+		if len(op.Data) > MaxScriptElement {
+			return fmt.Errorf("push of %d bytes exceeds %d", len(op.Data), MaxScriptElement)
+		}
+		if op.Opcode > OP_16 {
+			e.opCount++
+			if e.opCount > MaxOpsPerScript {
+				return fmt.Errorf("script exceeds %d operations", MaxOpsPerScript)
+			}
+		}
+
+		if err := e.step(op); err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+
+		if len(e.stack) > MaxStackSize {
+			return fmt.Errorf("stack exceeds %d items", MaxStackSize)
+		}
+	}
+
+	if len(e.condStack) != 0 {
+		return fmt.Errorf("unbalanced conditional")
+	}
+
+	return nil
+}
+
+func (e *Engine) step(op ScriptOp) error {
+	if !e.executing() {
+		switch op.Opcode {
+		case OP_IF, OP_NOTIF:
+			e.condStack = append(e.condStack, false)
+		case OP_ELSE, OP_ENDIF:
+			return e.stepConditional(op)
+		}
+		return nil
+	}
+
+	switch {
+	case op.Opcode <= OP_PUSHDATA2:
+		e.push(op.Data)
+		return nil
+	case op.Opcode == OP_1NEGATE:
+		e.pushNum(-1)
+		return nil
+	case op.Opcode >= OP_1 && op.Opcode <= OP_16:
+		e.pushNum(int64(op.Opcode - OP_1 + 1))
+		return nil
+	}
+
+	switch op.Opcode {
+	case OP_NOP:
+		return nil
+
+	case OP_IF, OP_NOTIF, OP_ELSE, OP_ENDIF:
+		return e.stepConditional(op)
+
+	case OP_VERIFY:
+		return e.verify()
+
+	case OP_RETURN:
+		return fmt.Errorf("script is unspendable")
+
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+
+	case OP_DUP:
+		top, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		e.push(top)
+
+	case OP_OVER:
+		second, err := e.peek(1)
+		if err != nil {
+			return err
+		}
+		e.push(second)
+
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return fmt.Errorf("stack underflow")
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+
+	case OP_SIZE:
+		top, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		e.pushNum(int64(len(top)))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.pushBool(bytes.Equal(a, b))
+		if op.Opcode == OP_EQUALVERIFY {
+			return e.verify()
+		}
+
+	case OP_1ADD, OP_1SUB, OP_NOT:
+		a, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		switch op.Opcode {
+		case OP_1ADD:
+			e.pushNum(a + 1)
+		case OP_1SUB:
+			e.pushNum(a - 1)
+		case OP_NOT:
+			e.pushBool(a == 0)
+		}
+
+	case OP_ADD, OP_SUB, OP_NUMEQUAL, OP_NUMEQUALVERIFY, OP_LESSTHAN, OP_GREATERTHAN:
+		b, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		a, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		switch op.Opcode {
+		case OP_ADD:
+			e.pushNum(a + b)
+		case OP_SUB:
+			e.pushNum(a - b)
+		case OP_NUMEQUAL, OP_NUMEQUALVERIFY:
+			e.pushBool(a == b)
+			if op.Opcode == OP_NUMEQUALVERIFY {
+				return e.verify()
+			}
+		case OP_LESSTHAN:
+			e.pushBool(a < b)
+		case OP_GREATERTHAN:
+			e.pushBool(a > b)
+		}
+
+	case OP_WITHIN:
+		upper, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		lower, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		x, err := e.popNum()
+		if err != nil {
+			return err
+		}
+		e.pushBool(lower <= x && x < upper)
+
+	case OP_SHA256:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		e.push(hash[:])
+
+	case OP_HASH160:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.push(wallet.PublicKeyHash(data))
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		signature, err := e.pop()
+		if err != nil {
+			return err
+		}
+		e.pushBool(len(signature) > 0 && e.checker != nil && e.checker.CheckSignature(signature, pubKey))
+		if op.Opcode == OP_CHECKSIGVERIFY {
+			return e.verify()
+		}
+
+	case OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY:
+		top, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		lock, err := DecodeScriptNum(top, maxLockTimeNumLength)
+		if err != nil {
+			return err
+		}
+		if lock < 0 {
+			return fmt.Errorf("negative lock %d", lock)
+		}
+
+		if op.Opcode == OP_CHECKLOCKTIMEVERIFY {
+			if e.checker == nil || !e.checker.CheckLockTime(lock) {
+				return fmt.Errorf("lock time %d not reached", lock)
+			}
+		} else if lock&SequenceDisableFlag == 0 {
+			if e.checker == nil || !e.checker.CheckSequence(lock) {
+				return fmt.Errorf("relative lock %#x not reached", lock)
+			}
+		}
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		if err := e.checkMultisig(); err != nil {
+			return err
+		}
+		if op.Opcode == OP_CHECKMULTISIGVERIFY {
+			return e.verify()
+		}
+
+	default:
+		return fmt.Errorf("unknown opcode")
+	}
+
+	return nil
+}
+
+func (e *Engine) checkMultisig() error {
+	n, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > MaxMultisigKeys {
+		return fmt.Errorf("invalid key count %d", n)
+	}
+	e.opCount += int(n)
+	if e.opCount > MaxOpsPerScript {
+		return fmt.Errorf("script exceeds %d operations", MaxOpsPerScript)
+	}
+
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	m, err := e.popNum()
+	if err != nil {
+		return err
+	}
+	if m < 1 || m > n {
+		return fmt.Errorf("invalid signature count %d", m)
+	}
+
+	signatures := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if signatures[i], err = e.pop(); err != nil {
+			return err
+		}
+	}
+
+	keyIdx := 0
+	for _, signature := range signatures {
+		matched := false
+		for !matched && keyIdx < len(pubKeys) {
+			matched = len(signature) > 0 && e.checker != nil && e.checker.CheckSignature(signature, pubKeys[keyIdx])
+			keyIdx++
+		}
+		if !matched {
+			e.pushBool(false)
+			return nil
+		}
+	}
+
+	e.pushBool(true)
+	return nil
+}
+
+func (e *Engine) stepConditional(op ScriptOp) error {
+	switch op.Opcode {
+	case OP_IF, OP_NOTIF:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		cond := castToBool(top)
+		if op.Opcode == OP_NOTIF {
+			cond = !cond
+		}
+		e.condStack = append(e.condStack, cond)
+
+	case OP_ELSE:
+		if len(e.condStack) == 0 {
+			return fmt.Errorf("OP_ELSE without OP_IF")
+		}
+		e.condStack[len(e.condStack)-1] = !e.condStack[len(e.condStack)-1]
+
+	case OP_ENDIF:
+		if len(e.condStack) == 0 {
+			return fmt.Errorf("OP_ENDIF without OP_IF")
+		}
+		e.condStack = e.condStack[:len(e.condStack)-1]
+	}
+
+	return nil
+}
+
+func (e *Engine) verify() error {
+	top, err := e.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(top) {
+		return fmt.Errorf("verify failed")
+	}
+	return nil
+}
+
+func (e *Engine) push(data []byte) {
+	e.stack = append(e.stack, append([]byte{}, data...))
+}
+
+func (e *Engine) pushNum(num int64) {
+	e.push(EncodeScriptNum(num))
+}
+
+func (e *Engine) pushBool(value bool) {
+	if value {
+		e.pushNum(1)
+	} else {
+		e.pushNum(0)
+	}
+}
+
+func (e *Engine) peek(depth int) ([]byte, error) {
+	if len(e.stack) <= depth {
+		return nil, fmt.Errorf("stack underflow")
+	}
+	return e.stack[len(e.stack)-1-depth], nil
+}
+
+func (e *Engine) pop() ([]byte, error) {
+	top, err := e.peek(0)
+	if err != nil {
+		return nil, err
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	return top, nil
+}
+
+func (e *Engine) popNum() (int64, error) {
+	top, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return DecodeScriptNum(top, maxScriptNumLength)
+}
@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// testChecker accepts one signature for any key, and locks up to lockTime
+// and sequence.
+type testChecker struct {
+	signature []byte
+	lockTime  int64
+	sequence  int64
+}
+
+func (c testChecker) CheckSignature(signature, pubKey []byte) bool {
+	return bytes.Equal(signature, c.signature)
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool { return lockTime <= c.lockTime }
+
+func (c testChecker) CheckSequence(sequence int64) bool { return sequence <= c.sequence }
+
+func TestExecuteWitness(t *testing.T) {
+	num := EncodeScriptNum
+	script := func(build func(b *ScriptBuilder)) Script {
+		b := NewScriptBuilder()
+		build(b)
+		return b.Script()
+	}
+
+	secret := []byte("secret")
+	hash := sha256.Sum256(secret)
+	pubKey := bytes.Repeat([]byte{2}, 33)
+	redeem := script(func(b *ScriptBuilder) { b.AddInt64(2).AddInt64(2).AddOp(OP_NUMEQUAL) })
+	failingRedeem := script(func(b *ScriptBuilder) { b.AddOp(OP_0) })
+
+	tests := []struct {
+		name    string
+		witness [][]byte
+		lock    Script
+		ok      bool
+	}{
+		{"true", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_1) }), true},
+		{"false", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_0) }), false},
+		{"empty stack", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_1).AddOp(OP_DROP) }), false},
+		{"underflow", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_DUP) }), false},
+		{"unknown opcode", nil, Script{0xff}, false},
+		{"return", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_RETURN) }), false},
+
+		{"add", nil, script(func(b *ScriptBuilder) { b.AddInt64(2).AddInt64(3).AddOp(OP_ADD).AddInt64(5).AddOp(OP_NUMEQUAL) }), true},
+		{"sub", nil, script(func(b *ScriptBuilder) { b.AddInt64(2).AddInt64(3).AddOp(OP_SUB).AddInt64(-1).AddOp(OP_NUMEQUAL) }), true},
+		{"within", [][]byte{num(5)}, script(func(b *ScriptBuilder) { b.AddInt64(1).AddInt64(10).AddOp(OP_WITHIN) }), true},
+		{"within upper bound", [][]byte{num(10)}, script(func(b *ScriptBuilder) { b.AddInt64(1).AddInt64(10).AddOp(OP_WITHIN) }), false},
+		{"number too long", [][]byte{{1, 2, 3, 4, 5}}, script(func(b *ScriptBuilder) { b.AddOp(OP_1ADD) }), false},
+		{"swap", [][]byte{num(1), num(2)}, script(func(b *ScriptBuilder) {
+			b.AddOp(OP_SWAP).AddInt64(1).AddOp(OP_EQUALVERIFY).AddInt64(2).AddOp(OP_EQUAL)
+		}), true},
+		{"size", [][]byte{[]byte("abc")}, script(func(b *ScriptBuilder) {
+			b.AddOp(OP_SIZE).AddInt64(3).AddOp(OP_EQUALVERIFY).AddOp(OP_DROP).AddOp(OP_1)
+		}), true},
+
+		{"if branch", [][]byte{num(1)}, script(func(b *ScriptBuilder) {
+			b.AddOp(OP_IF).AddOp(OP_1).AddOp(OP_ELSE).AddOp(OP_0).AddOp(OP_ENDIF)
+		}), true},
+		{"else branch", [][]byte{{}}, script(func(b *ScriptBuilder) {
+			b.AddOp(OP_IF).AddOp(OP_1).AddOp(OP_ELSE).AddOp(OP_0).AddOp(OP_ENDIF)
+		}), false},
+		{"notif", [][]byte{{}}, script(func(b *ScriptBuilder) { b.AddOp(OP_NOTIF).AddOp(OP_1).AddOp(OP_ENDIF) }), true},
+		{"unbalanced if", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_1).AddOp(OP_IF).AddOp(OP_1) }), false},
+		{"else without if", nil, script(func(b *ScriptBuilder) { b.AddOp(OP_1).AddOp(OP_ELSE) }), false},
+
+		{"preimage", [][]byte{secret}, script(func(b *ScriptBuilder) { b.AddOp(OP_SHA256).AddData(hash[:]).AddOp(OP_EQUAL) }), true},
+		{"wrong preimage", [][]byte{[]byte("guess")}, script(func(b *ScriptBuilder) { b.AddOp(OP_SHA256).AddData(hash[:]).AddOp(OP_EQUAL) }), false},
+
+		{"signature", [][]byte{[]byte("good"), pubKey}, P2PKHScript(wallet.PublicKeyHash(pubKey)), true},
+		{"bad signature", [][]byte{[]byte("bad"), pubKey}, P2PKHScript(wallet.PublicKeyHash(pubKey)), false},
+		{"wrong key", [][]byte{[]byte("good"), pubKey}, P2PKHScript(bytes.Repeat([]byte{1}, publicKeyHashLength)), false},
+		{"empty signature", [][]byte{{}, pubKey}, P2PKHScript(wallet.PublicKeyHash(pubKey)), false},
+
+		{"redeem script", [][]byte{redeem}, P2SHScript(wallet.PublicKeyHash(redeem)), true},
+		{"failing redeem script", [][]byte{failingRedeem}, P2SHScript(wallet.PublicKeyHash(failingRedeem)), false},
+		{"other redeem script", [][]byte{redeem}, P2SHScript(wallet.PublicKeyHash(failingRedeem)), false},
+
+		{"large witness item", [][]byte{make([]byte, MaxScriptElement+1)}, script(func(b *ScriptBuilder) { b.AddOp(OP_DROP).AddOp(OP_1) }), false},
+		{"too many operations", nil, append(bytes.Repeat([]byte{OP_NOP}, MaxOpsPerScript+1), OP_1), false},
+	}
+
+	checker := testChecker{signature: []byte("good")}
+	for _, test := range tests {
+		err := ExecuteWitness(test.witness, test.lock, checker)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: script %s succeeded", test.name, test.lock)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// The JSON forms below are meant for tooling. Hashes and scripts are hex,
+// addresses base58 and amounts decimal numbers of coins. When unmarshalling, an
+// output may give an address or a hex data payload instead of a script,
+// and an input without a sequence gets MaxSequence.
+
+type txInputJSON struct {
+	TxId     string   `json:"txid"`
+	Out      int      `json:"vout"`
+	Script   string   `json:"script"`
+	Asm      string   `json:"asm,omitempty"`
+	Sequence *uint32  `json:"sequence,omitempty"`
+	Witness  []string `json:"witness,omitempty"`
+}
+
+type txOutputJSON struct {
+	Value   Amount `json:"value"`
+	Script  string `json:"script,omitempty"`
+	Asm     string `json:"asm,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Address string `json:"address,omitempty"`
+	Data    string `json:"data,omitempty"`
+}
+
+type transactionJSON struct {
+	TxId        string     `json:"txid,omitempty"`
+	WitnessHash string     `json:"wtxid,omitempty"`
+	LockTime    uint32     `json:"locktime"`
+	Inputs      []TxInput  `json:"inputs"`
+	Outputs     []TxOutput `json:"outputs"`
+}
+
+type blockJSON struct {
+	Hash         string         `json:"hash"`
+	PrevHash     string         `json:"previousHash"`
+	Timestamp    uint           `json:"timestamp"`
+	Height       int            `json:"height"`
+	Nonce        int            `json:"nonce"`
+	Transactions []*Transaction `json:"transactions"`
+}
+
+// Type names the standard template a locking script follows.
+func (s Script) Type() string {
+	switch {
+	case s.IsP2PKH():
+		return "pubkeyhash"
+	case s.IsEd25519PKH():
+		return "ed25519pubkeyhash"
+	case s.IsP2SH():
+		return "scripthash"
+	case s.IsDataCarrier():
+		return "nulldata"
+	}
+
+	if _, _, err := ParseMultisigScript(s); err == nil {
+		return "multisig"
+	}
+	if _, err := ParseHTLCScript(s); err == nil {
+		return "htlc"
+	}
+
+	return "nonstandard"
+}
+
+func (in TxInput) MarshalJSON() ([]byte, error) {
+	sequence := in.Sequence
+
+	v := txInputJSON{
+		TxId:     hex.EncodeToString(in.Id),
+		Out:      in.Out,
+		Script:   hex.EncodeToString(in.Script),
+		Asm:      in.Script.String(),
+		Sequence: &sequence,
+	}
+	for _, item := range in.Witness {
+		v.Witness = append(v.Witness, hex.EncodeToString(item))
+	}
+
+	return json.Marshal(v)
+}
+
+func (in *TxInput) UnmarshalJSON(data []byte) error {
+	var v txInputJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	id, err := hex.DecodeString(v.TxId)
+	if err != nil {
+		return fmt.Errorf("input txid %q is not valid hex", v.TxId)
+	}
+	script, err := hex.DecodeString(v.Script)
+	if err != nil {
+		return fmt.Errorf("input script is not valid hex")
+	}
+
+	var witness [][]byte
+	for i, item := range v.Witness {
+		decoded, err := hex.DecodeString(item)
+		if err != nil {
+			return fmt.Errorf("witness item %d is not valid hex", i)
+		}
+		witness = append(witness, decoded)
+	}
+
+	*in = TxInput{id, v.Out, script, MaxSequence, witness}
+	if v.Sequence != nil {
+		in.Sequence = *v.Sequence
+	}
+
+	return nil
+}
+
+func (out TxOutput) MarshalJSON() ([]byte, error) {
+	v := txOutputJSON{
+		Value:   out.Value,
+		Script:  hex.EncodeToString(out.Script),
+		Asm:     out.Script.String(),
+		Type:    out.Script.Type(),
+		Address: out.Script.Address(),
+	}
+	if out.Script.IsDataCarrier() {
+		v.Data = hex.EncodeToString(out.Script.DataPayload())
+	}
+
+	return json.Marshal(v)
+}
+
+func (out *TxOutput) UnmarshalJSON(data []byte) error {
+	var v txOutputJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	var script Script
+
+	switch {
+	case v.Script != "":
+		decoded, err := hex.DecodeString(v.Script)
+		if err != nil {
+			return fmt.Errorf("output script is not valid hex")
+		}
+		script = decoded
+
+	case v.Address != "":
+		if _, _, err := wallet.ParseAddress(v.Address); err != nil {
+			return err
+		}
+		script = AddressScript(v.Address)
+
+	case v.Data != "":
+		payload, err := hex.DecodeString(v.Data)
+		if err != nil {
+			return fmt.Errorf("output data is not valid hex")
+		}
+		script = DataScript(payload)
+
+	default:
+		return fmt.Errorf("output needs a script, an address or data")
+	}
+
+	if v.Script != "" && v.Address != "" {
+		if _, _, err := wallet.ParseAddress(v.Address); err != nil {
+			return err
+		}
+		if !bytes.Equal(script, AddressScript(v.Address)) {
+			return fmt.Errorf("output script does not pay to %s", v.Address)
+		}
+	}
+
+	*out = TxOutput{v.Value, script}
+
+	return nil
+}
+
+func (tx Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(transactionJSON{
+		TxId:        hex.EncodeToString(tx.Id),
+		WitnessHash: hex.EncodeToString(tx.WitnessHash()),
+		LockTime:    tx.LockTime,
+		Inputs:      tx.Inputs,
+		Outputs:     tx.Outputs,
+	})
+}
+
+// UnmarshalJSON derives the id from the decoded contents. The txid and
+// wtxid in the JSON are optional, but must match when given.
+func (tx *Transaction) UnmarshalJSON(data []byte) error {
+	var v transactionJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*tx = Transaction{nil, v.Inputs, v.Outputs, v.LockTime}
+	tx.SetID()
+
+	if v.TxId != "" && v.TxId != hex.EncodeToString(tx.Id) {
+		return fmt.Errorf("txid %s does not match the transaction contents %x", v.TxId, tx.Id)
+	}
+	if v.WitnessHash != "" && v.WitnessHash != hex.EncodeToString(tx.WitnessHash()) {
+		return fmt.Errorf("wtxid %s does not match the transaction witnesses %x", v.WitnessHash, tx.WitnessHash())
+	}
+
+	return nil
+}
+
+func (b Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(blockJSON{
+		Hash:         hex.EncodeToString(b.Hash),
+		PrevHash:     hex.EncodeToString(b.PrevHash),
+		Timestamp:    b.Timestamp,
+		Height:       b.Height,
+		Nonce:        b.Nonce,
+		Transactions: append([]*Transaction{}, b.Transactions...),
+	})
+}
+
+func (b *Block) UnmarshalJSON(data []byte) error {
+	var v blockJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	hash, err := hex.DecodeString(v.Hash)
+	if err != nil {
+		return fmt.Errorf("block hash %q is not valid hex", v.Hash)
+	}
+	prevHash, err := hex.DecodeString(v.PrevHash)
+	if err != nil {
+		return fmt.Errorf("previous hash %q is not valid hex", v.PrevHash)
+	}
+
+	*b = Block{
+		Timestamp:    v.Timestamp,
+		PrevHash:     prevHash,
+		Transactions: v.Transactions,
+		Hash:         hash,
+		Nonce:        v.Nonce,
+		Height:       v.Height,
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+// MempoolMinFeeHalfLife is how fast the minimum fee raised by evictions
+// falls back to the minimum relay fee.
+const MempoolMinFeeHalfLife = 12 * time.Hour
+
+var mempoolMinFeeKey = []byte("mempool-minfee")
+
+// MempoolInfo sums up the pool. Oldest is nil for an empty pool.
+type MempoolInfo struct {
+	Count    int
+	Bytes    int
+	MaxBytes int
+	MinFee   FeeRate
+	Oldest   *MempoolEntry
+	Orphans  int
+}
+
+func (pool *Mempool) Info() MempoolInfo {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	info := MempoolInfo{
+		Count:    len(pool.entries),
+		Bytes:    pool.size,
+		MaxBytes: pool.policy.MaxMempoolSize,
+		MinFee:   pool.minFee(time.Now().Unix()),
+		Orphans:  len(pool.orphans.orphans),
+	}
+	for _, entry := range pool.sortedEntries() {
+		if info.Oldest == nil || entry.Time < info.Oldest.Time {
+			info.Oldest = entry
+		}
+	}
+
+	return info
+}
+
+// MinFee is the least fee rate the pool takes: the minimum relay fee of
+// the policy, or more for a while after the pool was full.
+func (pool *Mempool) MinFee() FeeRate {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.minFee(time.Now().Unix())
+}
+
+// minFee halves the rate set by the last eviction every
+// MempoolMinFeeHalfLife until it is below the minimum relay fee.
+func (pool *Mempool) minFee(now int64) FeeRate {
+	rate := pool.policy.MinRelayFee
+
+	if pool.rollingMinFee > 0 {
+		halvings := float64(now-pool.minFeeTime) / MempoolMinFeeHalfLife.Seconds()
+		rolling := FeeRate(float64(pool.rollingMinFee) / math.Pow(2, math.Max(halvings, 0)))
+		if rolling > rate {
+			rate = rolling
+		}
+	}
+
+	return rate
+}
+
+// limit drops the entries older than the policy expiry, and then trims the
+// pool to its maximum size.
+func (pool *Mempool) limit() error {
+	now := time.Now().Unix()
+	removed := append(pool.expire(now), pool.trim(now)...)
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	return pool.save(nil, removed)
+}
+
+func (pool *Mempool) expire(now int64) []*MempoolEntry {
+	var expired []*MempoolEntry
+	limit := now - int64(pool.policy.MempoolExpiry)*int64(time.Hour/time.Second)
+
+	for _, entry := range pool.sortedEntries() {
+		if _, ok := pool.entries[hex.EncodeToString(entry.Tx.Id)]; ok && entry.Time < limit {
+			expired = append(expired, pool.removeWithDescendants(entry)...)
+		}
+	}
+
+	return expired
+}
+
+// trim evicts the package with the lowest fee rate, an entry together with
+// its descendants, until the pool fits. The minimum fee rises above the
+// rate of every package evicted.
+func (pool *Mempool) trim(now int64) []*MempoolEntry {
+	if pool.size <= pool.policy.MaxMempoolSize {
+		return nil
+	}
+
+	// The package rates are computed once and, after an eviction, again
+	// only for the ancestors of the evicted entries, the only packages
+	// that changed.
+	sorted := pool.sortedEntries()
+	rates := make(map[*MempoolEntry]FeeRate, len(sorted))
+	for _, entry := range sorted {
+		rates[entry] = packageFeeRate(append([]*MempoolEntry{entry}, pool.descendants(entry)...))
+	}
+
+	var evicted []*MempoolEntry
+
+	for pool.size > pool.policy.MaxMempoolSize {
+		var worst *MempoolEntry
+		var worstRate FeeRate
+
+		for _, entry := range sorted {
+			if rate, ok := rates[entry]; ok && (worst == nil || rate <= worstRate) {
+				worst, worstRate = entry, rate
+			}
+		}
+
+		// Entries whose sizes do not add up to pool.size leave nothing
+		// to evict.
+		if worst == nil {
+			break
+		}
+
+		removed := pool.removeWithDescendants(worst)
+		evicted = append(evicted, removed...)
+
+		changed := make(map[*MempoolEntry]bool)
+		for _, entry := range removed {
+			delete(rates, entry)
+			for _, ancestor := range pool.ancestors(entry) {
+				changed[ancestor] = true
+			}
+		}
+		for entry := range changed {
+			if _, ok := rates[entry]; ok {
+				rates[entry] = packageFeeRate(append([]*MempoolEntry{entry}, pool.descendants(entry)...))
+			}
+		}
+
+		if rate := worstRate + IncrementalRelayFee; rate > pool.minFee(now) {
+			pool.rollingMinFee, pool.minFeeTime = rate, now
+		}
+	}
+
+	return evicted
+}
+
+// checkMinFee refuses entry when it pays less than the minimum fee rate.
+func (pool *Mempool) checkMinFee(entry *MempoolEntry) error {
+	if min := pool.minFee(entry.Time); entry.FeeRate() < min {
+		return fmt.Errorf("transaction %x pays %s, below the minimum fee rate of %s", entry.Tx.Id, entry.FeeRate(), min)
+	}
+
+	return nil
+}
+
+func (pool *Mempool) loadMinFee(txn *badger.Txn) error {
+	item, err := txn.Get(mempoolMinFeeKey)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	d := newDecoder(data)
+	pool.rollingMinFee, pool.minFeeTime = d.minFee()
+	if err := d.Finish("minimum fee"); err != nil {
+		return fmt.Errorf("invalid minimum fee: %v", err)
+	}
+
+	return nil
+}
+
+func (pool *Mempool) putMinFee(txn *badger.Txn) error {
+	var e encoder
+	e.putMinFee(pool.rollingMinFee, pool.minFeeTime)
+
+	return txn.Set(mempoolMinFeeKey, e.Bytes())
+}
@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func testMempool(maxSize int) *Mempool {
+	policy := DefaultPolicy
+	policy.MaxMempoolSize = maxSize
+
+	return &Mempool{
+		entries: make(map[string]*MempoolEntry),
+		spends:  make(map[string]*MempoolEntry),
+		policy:  policy,
+	}
+}
+
+// addTestEntry adds an entry of size bytes paying fee to pool. It spends
+// the first output of parent or, without one, of a made up transaction.
+func addTestEntry(pool *Mempool, parent *MempoolEntry, fee Amount, size int) *MempoolEntry {
+	n := len(pool.entries)
+	prevId := bytes.Repeat([]byte{byte(n + 1)}, 32)
+	if parent != nil {
+		prevId = parent.Tx.Id
+	}
+
+	tx := &Transaction{
+		Inputs:  []TxInput{{Id: prevId, Out: 0, Sequence: MaxSequence}},
+		Outputs: []TxOutput{*NewTxOutput(Coin, testAddress(byte(n)))},
+	}
+	tx.SetID()
+
+	entry := &MempoolEntry{
+		Tx:       tx,
+		Fee:      fee,
+		Size:     size,
+		Time:     int64(n),
+		parents:  make(map[string]*MempoolEntry),
+		children: make(map[string]*MempoolEntry),
+	}
+	pool.entries[hex.EncodeToString(tx.Id)] = entry
+	pool.link(entry)
+
+	return entry
+}
+
+func TestTrimEvictsLowestPackages(t *testing.T) {
+	pool := testMempool(3000)
+
+	low := addTestEntry(pool, nil, 2000, 1000)
+	parent := addTestEntry(pool, nil, 1500, 1000)
+	child := addTestEntry(pool, parent, 9000, 1000)
+	single := addTestEntry(pool, nil, 5000, 1000)
+
+	// The parent pays the least, but its child lifts the package to 5250
+	// per 1000 bytes, above both others.
+	evicted := pool.trim(100)
+	if len(evicted) != 1 || evicted[0] != low {
+		t.Fatalf("evicted %d entries, want only the lowest paying one", len(evicted))
+	}
+	if pool.size != 3000 {
+		t.Errorf("pool size = %d, want 3000", pool.size)
+	}
+	if want := NewFeeRate(2000, 1000) + IncrementalRelayFee; pool.rollingMinFee != want {
+		t.Errorf("minimum fee = %s, want %s", pool.rollingMinFee, want)
+	}
+
+	pool.policy.MaxMempoolSize = 1000
+	evicted = pool.trim(100)
+	if len(evicted) != 3 || evicted[0] != single || evicted[1] != parent || evicted[2] != child {
+		t.Fatalf("evicted %d entries, want the single entry and then the package", len(evicted))
+	}
+	if pool.size != 0 || len(pool.entries) != 0 || len(pool.spends) != 0 {
+		t.Errorf("pool of %d entries and %d bytes left, want it empty", len(pool.entries), pool.size)
+	}
+}
+
+func TestTrimRescoresAncestors(t *testing.T) {
+	pool := testMempool(1000)
+
+	parent := addTestEntry(pool, nil, 9000, 1000)
+	child := addTestEntry(pool, parent, 1000, 1000)
+	single := addTestEntry(pool, nil, 4000, 1000)
+
+	// Evicting the child alone raises its parent from 5000 to 9000 per
+	// 1000 bytes, above the single entry evicted next.
+	evicted := pool.trim(100)
+	if len(evicted) != 2 || evicted[0] != child || evicted[1] != single {
+		t.Fatalf("evicted %d entries, want the child and then the single entry", len(evicted))
+	}
+	if _, ok := pool.entries[hex.EncodeToString(parent.Tx.Id)]; !ok {
+		t.Error("the parent was evicted")
+	}
+}
+
+func TestTrimEvictsDescendants(t *testing.T) {
+	pool := testMempool(1000)
+
+	single := addTestEntry(pool, nil, 5000, 500)
+	parent := addTestEntry(pool, nil, 100, 400)
+	child := addTestEntry(pool, parent, 100, 300)
+	sibling := addTestEntry(pool, parent, 200, 300)
+	grandchild := addTestEntry(pool, child, 100, 200)
+
+	// The child and its own child pay the least together, after which
+	// the parent is left at 428 per 1000 bytes with the sibling.
+	evicted := pool.trim(100)
+	want := []*MempoolEntry{child, grandchild, parent, sibling}
+	if len(evicted) != len(want) {
+		t.Fatalf("evicted %d entries, want %d", len(evicted), len(want))
+	}
+	for i, entry := range want {
+		if evicted[i] != entry {
+			t.Errorf("eviction %d was entry %x, want %x", i, evicted[i].Tx.Id, entry.Tx.Id)
+		}
+	}
+
+	if pool.size != single.Size {
+		t.Errorf("pool size = %d, want %d", pool.size, single.Size)
+	}
+	if len(pool.entries) != 1 || len(pool.spends) != 1 {
+		t.Errorf("pool of %d entries spending %d outputs left, want only the single entry", len(pool.entries), len(pool.spends))
+	}
+}
+
+func TestTrimStopsWithoutEntries(t *testing.T) {
+	pool := testMempool(1000)
+	pool.size = 2000
+
+	if evicted := pool.trim(100); len(evicted) != 0 {
+		t.Errorf("evicted %d entries from an empty pool", len(evicted))
+	}
+}
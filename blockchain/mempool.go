@@ -0,0 +1,627 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+var (
+	mempoolPrefix = []byte("mempool/")
+	mempoolTipKey = []byte("mempool-tip")
+)
+
+// MempoolEntry is a validated transaction waiting for a block. Fee is the
+// input value it leaves to the miner and Height the chain height when it
+// was accepted.
+type MempoolEntry struct {
+	Tx     *Transaction
+	Fee    Amount
+	Size   int
+	Time   int64
+	Height int
+
+	parents  map[string]*MempoolEntry
+	children map[string]*MempoolEntry
+}
+
+// Mempool holds transactions that passed validation but are not mined yet.
+// It is kept in the chain database next to the blocks, so a transaction
+// queued by one command is mined by a later one. Entries may spend outputs
+// of other entries, their parents, which are always mined first.
+// Transactions whose parents are unknown wait in the orphans.
+type Mempool struct {
+	chain   *BlockChain
+	entries map[string]*MempoolEntry
+	spends  map[string]*MempoolEntry
+	size    int
+	orphans *orphanPool
+	fees    *feeEstimator
+	policy  Policy
+	tip     []byte
+
+	rollingMinFee FeeRate
+	minFeeTime    int64
+	mu            sync.Mutex
+}
+
+// NewMempool loads the pool of chain, which from then on only takes
+// transactions that follow policy.
+func NewMempool(chain *BlockChain, policy Policy) (*Mempool, error) {
+	pool := &Mempool{
+		chain:   chain,
+		entries: make(map[string]*MempoolEntry),
+		spends:  make(map[string]*MempoolEntry),
+		orphans: newOrphanPool(MaxOrphanTransactions),
+		fees:    newFeeEstimator(),
+		policy:  policy,
+	}
+
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		if err := pool.loadOrphans(txn); err != nil {
+			return err
+		}
+		if err := pool.loadFeeEstimates(txn); err != nil {
+			return err
+		}
+		if err := pool.loadMinFee(txn); err != nil {
+			return err
+		}
+
+		item, err := txn.Get(mempoolTipKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if pool.tip, err = item.ValueCopy(nil); err != nil {
+			return err
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = mempoolPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			data, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			d := newDecoder(data)
+			entry := d.poolEntry()
+			if err := d.Finish("pool entry"); err != nil {
+				return fmt.Errorf("invalid pool entry %x: %v", it.Item().Key()[len(mempoolPrefix):], err)
+			}
+
+			entry.parents = make(map[string]*MempoolEntry)
+			entry.children = make(map[string]*MempoolEntry)
+			pool.entries[hex.EncodeToString(entry.Tx.Id)] = entry
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range pool.entries {
+		pool.link(entry)
+	}
+
+	if err := pool.expireOrphans(); err != nil {
+		return nil, err
+	}
+	if err := pool.sync(); err != nil {
+		return nil, err
+	}
+
+	return pool, pool.limit()
+}
+
+// Add validates tx against the chain and the pool and queues it, together
+// with the orphans that were waiting for it. A transaction spending unknown
+// outputs is kept as an orphan and Add returns a *MissingParentsError.
+func (pool *Mempool) Add(tx *Transaction) (*MempoolEntry, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if err := pool.expireOrphans(); err != nil {
+		return nil, err
+	}
+
+	entry, err := pool.accept(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.acceptOrphans([][]byte{tx.Id}); err != nil {
+		return nil, err
+	}
+	if err := pool.limit(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := pool.entries[hex.EncodeToString(tx.Id)]; !ok {
+		return nil, fmt.Errorf("memory pool is full, transaction %x pays too little to stay", tx.Id)
+	}
+
+	return entry, nil
+}
+
+// validate checks tx for the pool and returns its entry together with the
+// entries it replaces.
+func (pool *Mempool) validate(tx *Transaction) (*MempoolEntry, []*MempoolEntry, error) {
+	if tx.IsCoinbase() {
+		return nil, nil, fmt.Errorf("coinbase transaction %x cannot be added to the memory pool", tx.Id)
+	}
+	if id := tx.Hash(); !bytes.Equal(tx.Id, id) {
+		return nil, nil, fmt.Errorf("transaction %x has the id %x", id, tx.Id)
+	}
+	if _, ok := pool.entries[hex.EncodeToString(tx.Id)]; ok {
+		return nil, nil, fmt.Errorf("transaction %x is already in the memory pool", tx.Id)
+	}
+	if err := tx.CheckOutputs(); err != nil {
+		return nil, nil, err
+	}
+	if err := pool.policy.CheckTransaction(tx); err != nil {
+		return nil, nil, err
+	}
+	if size := tx.Size(); size > MaxBlockSize {
+		return nil, nil, fmt.Errorf("transaction %x of %d bytes does not fit in a block", tx.Id, size)
+	}
+	if _, err := pool.chain.FindTransaction(tx.Id); err == nil {
+		return nil, nil, fmt.Errorf("transaction %x is already in the chain", tx.Id)
+	}
+
+	conflicts, err := pool.conflicts(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if missing := pool.missingParents(tx); len(missing) > 0 {
+		return nil, nil, &MissingParentsError{"transaction", tx.Id, missing}
+	}
+
+	pending := pool.pending(tx)
+	prevTxs, err := pool.chain.previousTransactions(tx, pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	fee, err := pool.chain.checkTransactionInputs(tx, prevTxs, make(map[string]bool))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pool.policy.CheckWitnesses(tx, prevTxs); err != nil {
+		return nil, nil, err
+	}
+
+	entry := &MempoolEntry{
+		Tx:       tx,
+		Fee:      fee,
+		Size:     tx.Size(),
+		Time:     time.Now().Unix(),
+		Height:   pool.chain.Height(),
+		parents:  make(map[string]*MempoolEntry),
+		children: make(map[string]*MempoolEntry),
+	}
+
+	if err := pool.checkMinFee(entry); err != nil {
+		return nil, nil, err
+	}
+
+	replaced, err := pool.checkReplacement(entry, conflicts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = pool.chain.checkTransactionLocks(tx, entry.Height+1, pool.chain.MedianTimePast(pool.chain.LastHash), pending)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checks, err := tx.inputChecks(prevTxs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verifyInputs(checks, VerifiedInputs); err != nil {
+		return nil, nil, err
+	}
+
+	return entry, replaced, nil
+}
+
+// pending returns the pool transactions tx spends from.
+func (pool *Mempool) pending(tx *Transaction) map[string]*Transaction {
+	pending := make(map[string]*Transaction)
+
+	for _, in := range tx.Inputs {
+		if parent, ok := pool.entries[hex.EncodeToString(in.Id)]; ok {
+			pending[hex.EncodeToString(in.Id)] = parent.Tx
+		}
+	}
+
+	return pending
+}
+
+// link indexes an entry just added to pool.entries.
+func (pool *Mempool) link(entry *MempoolEntry) {
+	id := hex.EncodeToString(entry.Tx.Id)
+	pool.size += entry.Size
+
+	for _, in := range entry.Tx.Inputs {
+		pool.spends[outpoint(in.Id, in.Out)] = entry
+
+		if parent, ok := pool.entries[hex.EncodeToString(in.Id)]; ok {
+			entry.parents[hex.EncodeToString(in.Id)] = parent
+			parent.children[id] = entry
+		}
+	}
+}
+
+func (pool *Mempool) remove(entry *MempoolEntry) {
+	id := hex.EncodeToString(entry.Tx.Id)
+	if pool.entries[id] != entry {
+		return
+	}
+
+	delete(pool.entries, id)
+	pool.size -= entry.Size
+	for _, in := range entry.Tx.Inputs {
+		if pool.spends[outpoint(in.Id, in.Out)] == entry {
+			delete(pool.spends, outpoint(in.Id, in.Out))
+		}
+	}
+	for _, parent := range entry.parents {
+		delete(parent.children, id)
+	}
+	for _, child := range entry.children {
+		delete(child.parents, id)
+	}
+}
+
+// removeWithDescendants drops entry and everything spending its outputs,
+// which can never be mined without it.
+func (pool *Mempool) removeWithDescendants(entry *MempoolEntry) []*MempoolEntry {
+	removed := append([]*MempoolEntry{entry}, pool.descendants(entry)...)
+
+	for _, e := range removed {
+		pool.remove(e)
+	}
+
+	return removed
+}
+
+// connectBlock drops the entries block confirms, counting how long they
+// waited for the fee estimates, and those spending an output the block
+// spends as well.
+func (pool *Mempool) connectBlock(block *Block) []*MempoolEntry {
+	var removed []*MempoolEntry
+
+	pool.fees.advance(block.Height)
+	for _, tx := range block.Transactions {
+		if entry, ok := pool.entries[hex.EncodeToString(tx.Id)]; ok {
+			pool.fees.record(entry, block.Height)
+			pool.remove(entry)
+			removed = append(removed, entry)
+			continue
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for _, in := range tx.Inputs {
+			if spender, ok := pool.spends[outpoint(in.Id, in.Out)]; ok {
+				removed = append(removed, pool.removeWithDescendants(spender)...)
+			}
+		}
+	}
+
+	return removed
+}
+
+// Sync catches up with blocks added to the chain by others than the pool.
+func (pool *Mempool) Sync() error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.sync()
+}
+
+// sync connects the blocks mined since the pool was last saved and retries
+// the orphans they were the missing parents of. When the chain switched to
+// another branch since, the blocks that left it are disconnected first.
+func (pool *Mempool) sync() error {
+	if bytes.Equal(pool.tip, pool.chain.LastHash) {
+		return nil
+	}
+
+	var detached, attached []*Block
+	if len(pool.tip) > 0 {
+		var err error
+		detached, attached, err = pool.chain.branches(pool.tip, pool.chain.LastHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	var removed []*MempoolEntry
+	var confirmed [][]byte
+	for _, block := range attached {
+		removed = append(removed, pool.connectBlock(block)...)
+		for _, tx := range block.Transactions {
+			confirmed = append(confirmed, tx.Id)
+		}
+	}
+	pool.tip = pool.chain.LastHash
+	pool.fees.advance(pool.chain.Height())
+
+	var restored []*MempoolEntry
+	if len(detached) > 0 {
+		dropped, kept := pool.disconnectBlocks(detached)
+		removed = append(removed, dropped...)
+		restored = kept
+	}
+
+	if err := pool.save(restored, removed); err != nil {
+		return err
+	}
+	if err := pool.saveFeeEstimates(); err != nil {
+		return err
+	}
+	if err := pool.acceptOrphans(confirmed); err != nil {
+		return err
+	}
+
+	return pool.limit()
+}
+
+// disconnectBlocks returns the transactions of blocks, which left the
+// chain, newest first, to the pool. The entries are checked again after
+// them, since what they spend may have left the chain as well. It returns
+// the entries dropped and those kept, which keep their time and height.
+func (pool *Mempool) disconnectBlocks(blocks []*Block) ([]*MempoolEntry, []*MempoolEntry) {
+	entries := pool.sortedEntries()
+	for _, entry := range entries {
+		pool.remove(entry)
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i].Transactions {
+			if !tx.IsCoinbase() {
+				_, _ = pool.accept(tx)
+			}
+		}
+	}
+
+	var dropped, kept []*MempoolEntry
+	for _, entry := range entries {
+		restored, err := pool.accept(entry.Tx)
+		if err != nil {
+			dropped = append(dropped, entry)
+			continue
+		}
+		restored.Time, restored.Height = entry.Time, entry.Height
+		kept = append(kept, restored)
+	}
+
+	return dropped, kept
+}
+
+func (pool *Mempool) save(added, removed []*MempoolEntry) error {
+	return pool.chain.Database.Update(func(txn *badger.Txn) error {
+		for _, entry := range removed {
+			if err := txn.Delete(poolKey(entry.Tx.Id)); err != nil {
+				return err
+			}
+		}
+		for _, entry := range added {
+			var e encoder
+			e.putPoolEntry(entry)
+			if err := txn.Set(poolKey(entry.Tx.Id), e.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		if err := pool.putMinFee(txn); err != nil {
+			return err
+		}
+
+		return txn.Set(mempoolTipKey, pool.tip)
+	})
+}
+
+// Entries lists the pool with every entry after its parents.
+func (pool *Mempool) Entries() []*MempoolEntry {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.sortedEntries()
+}
+
+func (pool *Mempool) sortedEntries() []*MempoolEntry {
+	var byTime, sorted []*MempoolEntry
+	visited := make(map[*MempoolEntry]bool)
+
+	for _, entry := range pool.entries {
+		byTime = append(byTime, entry)
+	}
+	sort.Slice(byTime, func(i, j int) bool {
+		if byTime[i].Time != byTime[j].Time {
+			return byTime[i].Time < byTime[j].Time
+		}
+		return bytes.Compare(byTime[i].Tx.Id, byTime[j].Tx.Id) < 0
+	})
+
+	var visit func(entry *MempoolEntry)
+	visit = func(entry *MempoolEntry) {
+		if visited[entry] {
+			return
+		}
+		visited[entry] = true
+		for _, parent := range entry.parents {
+			visit(parent)
+		}
+		sorted = append(sorted, entry)
+	}
+	for _, entry := range byTime {
+		visit(entry)
+	}
+
+	return sorted
+}
+
+func (entry *MempoolEntry) FeeRate() FeeRate {
+	return NewFeeRate(entry.Fee, entry.Size)
+}
+
+// PackageFeeRate is the fee rate of entry together with its unconfirmed
+// ancestors, which a block has to include with it.
+func (pool *Mempool) PackageFeeRate(entry *MempoolEntry) FeeRate {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return packageFeeRate(append([]*MempoolEntry{entry}, pool.ancestors(entry)...))
+}
+
+// EffectiveFeeRate is the best rate entry is mined at, either in its own
+// package or in that of a descendant paying for it.
+func (pool *Mempool) EffectiveFeeRate(entry *MempoolEntry) FeeRate {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	rate := packageFeeRate(append([]*MempoolEntry{entry}, pool.ancestors(entry)...))
+	for _, descendant := range pool.descendants(entry) {
+		if r := packageFeeRate(append([]*MempoolEntry{descendant}, pool.ancestors(descendant)...)); r > rate {
+			rate = r
+		}
+	}
+
+	return rate
+}
+
+func (pool *Mempool) Entry(id []byte) (*MempoolEntry, bool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	entry, ok := pool.entries[hex.EncodeToString(id)]
+	return entry, ok
+}
+
+func (pool *Mempool) Len() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return len(pool.entries)
+}
+
+// Ancestors returns the unconfirmed transactions entry depends on.
+func (pool *Mempool) Ancestors(entry *MempoolEntry) []*MempoolEntry {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.ancestors(entry)
+}
+
+func (pool *Mempool) ancestors(entry *MempoolEntry) []*MempoolEntry {
+	return walkEntries(entry, func(e *MempoolEntry) map[string]*MempoolEntry { return e.parents })
+}
+
+// Descendants returns the transactions that spend outputs of entry,
+// directly or further down.
+func (pool *Mempool) Descendants(entry *MempoolEntry) []*MempoolEntry {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.descendants(entry)
+}
+
+func (pool *Mempool) descendants(entry *MempoolEntry) []*MempoolEntry {
+	return walkEntries(entry, func(e *MempoolEntry) map[string]*MempoolEntry { return e.children })
+}
+
+func walkEntries(entry *MempoolEntry, next func(*MempoolEntry) map[string]*MempoolEntry) []*MempoolEntry {
+	var found []*MempoolEntry
+	seen := map[*MempoolEntry]bool{entry: true}
+	queue := []*MempoolEntry{entry}
+
+	for len(queue) > 0 {
+		for _, e := range next(queue[0]) {
+			if !seen[e] {
+				seen[e] = true
+				found = append(found, e)
+				queue = append(queue, e)
+			}
+		}
+		queue = queue[1:]
+	}
+
+	return found
+}
+
+// FindUnspentOutputs adds the outputs of pool transactions to those of the
+// chain and leaves out what the pool already spends.
+func (pool *Mempool) FindUnspentOutputs(publicKeyHash []byte) []UnspentOutput {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var utxos []UnspentOutput
+
+	for _, utxo := range pool.chain.FindUnspentOutputs(publicKeyHash) {
+		if _, spent := pool.spends[outpoint(utxo.TxId, utxo.Index)]; !spent {
+			utxos = append(utxos, utxo)
+		}
+	}
+
+	for _, entry := range pool.sortedEntries() {
+		for outIdx, out := range entry.Tx.Outputs {
+			if _, spent := pool.spends[outpoint(entry.Tx.Id, outIdx)]; spent {
+				continue
+			}
+			if !out.Script.IsUnspendable() && out.IsLockedWithKey(publicKeyHash) {
+				utxos = append(utxos, UnspentOutput{entry.Tx.Id, outIdx, out})
+			}
+		}
+	}
+
+	return utxos
+}
+
+func (pool *Mempool) PreviousTransactions(tx *Transaction) (map[string]Transaction, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.chain.previousTransactions(tx, pool.pending(tx))
+}
+
+// FindTransaction looks in the pool before it searches the chain.
+func (pool *Mempool) FindTransaction(id []byte) (Transaction, error) {
+	if entry, ok := pool.Entry(id); ok {
+		return *entry.Tx, nil
+	}
+
+	return pool.chain.FindTransaction(id)
+}
+
+// IsSpent reports whether a block or a pool transaction spends the output.
+func (pool *Mempool) IsSpent(id []byte, out int) bool {
+	pool.mu.Lock()
+	_, spent := pool.spends[outpoint(id, out)]
+	pool.mu.Unlock()
+
+	return spent || pool.chain.IsSpent(id, out)
+}
+
+func outpoint(id []byte, out int) string {
+	return fmt.Sprintf("%x:%d", id, out)
+}
+
+func poolKey(id []byte) []byte {
+	return append(append([]byte{}, mempoolPrefix...), id...)
+}
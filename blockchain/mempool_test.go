@@ -0,0 +1,50 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// testPoolSpend starts a chain paying its genesis block to a new wallet and
+// returns its pool with a signed spend of the genesis output, paying fee.
+func testPoolSpend(t *testing.T, fee Amount) (*BlockChain, *Mempool, *Transaction) {
+	t.Helper()
+
+	w := wallet.NewWallet(wallet.P256)
+	chain := testChain(t, string(w.Address()))
+	pool, err := NewMempool(chain, DefaultPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &Transaction{
+		Inputs:  []TxInput{{Id: genesis.Transactions[0].Id, Out: 0, Sequence: MaxSequence}},
+		Outputs: []TxOutput{*NewTxOutput(Subsidy-fee, testAddress(4))},
+	}
+	tx.SetID()
+	if err := chain.SignTransaction(tx, *w); err != nil {
+		t.Fatal(err)
+	}
+
+	return chain, pool, tx
+}
+
+func TestMempoolRejectsWrongId(t *testing.T) {
+	_, pool, tx := testPoolSpend(t, Coin)
+
+	tx.Id = bytes.Repeat([]byte{0xee}, 32)
+	if _, err := pool.Add(tx); err == nil {
+		t.Fatal("transaction with a forged id was accepted")
+	}
+
+	tx.SetID()
+	if _, err := pool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// PartialTransaction is a spend from a multisig address that is passed
+// between the key holders until enough of them have signed it.
+type PartialTransaction struct {
+	Tx           Transaction
+	PrevOutputs  []TxOutput
+	RedeemScript Script
+	Signatures   []map[string][]byte
+}
+
+func NewMultisigTransaction(redeemScript Script, payments []Payment, view UTXOView, options SendOptions) (*PartialTransaction, error) {
+	m, _, err := ParseMultisigScript(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	address := string(wallet.MultisigAddress(redeemScript))
+	utxos := view.FindUnspentOutputs(wallet.PublicKeyHash(redeemScript))
+
+	// The witness holds m signatures and the redeem script.
+	witnessSize := 4 + m*(4+72) + 4 + len(redeemScript)
+	tx, err := fundTransaction(nil, utxos, PaymentOutputs(payments), address, options, witnessSize, options.FeeRate.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	pt := PartialTransaction{Tx: *tx, RedeemScript: redeemScript}
+
+	for _, in := range tx.Inputs {
+		for _, utxo := range utxos {
+			if bytes.Equal(utxo.TxId, in.Id) && utxo.Index == in.Out {
+				pt.PrevOutputs = append(pt.PrevOutputs, utxo.Output)
+				break
+			}
+		}
+		pt.Signatures = append(pt.Signatures, make(map[string][]byte))
+	}
+
+	return &pt, nil
+}
+
+func (pt *PartialTransaction) Sign(w wallet.Wallet) error {
+	pubKey := w.PublicKey
+
+	_, pubKeys, err := ParseMultisigScript(pt.RedeemScript)
+	if err != nil {
+		return err
+	}
+
+	member := false
+	for _, key := range pubKeys {
+		if bytes.Equal(key, pubKey) {
+			member = true
+		}
+	}
+	if !member {
+		return fmt.Errorf("key %x is not part of this multisig address", pubKey)
+	}
+
+	for inId := range pt.Tx.Inputs {
+		hash := pt.Tx.SignatureHash(inId, pt.PrevOutputs[inId])
+		pt.Signatures[inId][hex.EncodeToString(pubKey)] = w.Sign(hash)
+	}
+
+	return nil
+}
+
+func (pt *PartialTransaction) SignatureCount() int {
+	count := -1
+	for _, signatures := range pt.Signatures {
+		if count == -1 || len(signatures) < count {
+			count = len(signatures)
+		}
+	}
+
+	if count == -1 {
+		return 0
+	}
+
+	return count
+}
+
+func (pt *PartialTransaction) Required() int {
+	m, _, err := ParseMultisigScript(pt.RedeemScript)
+	if err != nil {
+		return 0
+	}
+
+	return m
+}
+
+// Complete assembles the unlocking scripts once at least m key holders
+// have signed, ordering signatures to match the sorted keys in the
+// redeem script.
+func (pt *PartialTransaction) Complete() (*Transaction, error) {
+	m, pubKeys, err := ParseMultisigScript(pt.RedeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := pt.Tx
+	tx.Inputs = append([]TxInput{}, pt.Tx.Inputs...)
+
+	for inId := range tx.Inputs {
+		var witness [][]byte
+		count := 0
+
+		for _, pubKey := range pubKeys {
+			signature, ok := pt.Signatures[inId][hex.EncodeToString(pubKey)]
+			if !ok || count == m {
+				continue
+			}
+			witness = append(witness, signature)
+			count++
+		}
+
+		if count < m {
+			return nil, fmt.Errorf("input %d has %d of %d required signatures", inId, count, m)
+		}
+
+		tx.Inputs[inId].Witness = append(witness, pt.RedeemScript)
+
+		if err := tx.VerifyInput(inId, pt.PrevOutputs[inId]); err != nil {
+			return nil, fmt.Errorf("input %d: %v", inId, err)
+		}
+	}
+
+	return &tx, nil
+}
+
+func (pt *PartialTransaction) Serialize() []byte {
+	var e encoder
+	e.putPartialTransaction(pt)
+
+	return e.Bytes()
+}
+
+// DeserializePartialTransaction decodes a multisig spend. The transaction
+// id is derived again rather than taken from the data.
+func DeserializePartialTransaction(data []byte) (*PartialTransaction, error) {
+	d := newDecoder(data)
+	pt := d.partialTransaction()
+	if err := d.Finish("multisig transaction"); err != nil {
+		return nil, fmt.Errorf("invalid multisig transaction: %v", err)
+	}
+
+	return pt, nil
+}
@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// testMultisigSpend returns the wallets of an m-of-n address and an
+// unsigned spend of an output paid to it.
+func testMultisigSpend(t *testing.T, m, n int) ([]*wallet.Wallet, *PartialTransaction) {
+	t.Helper()
+
+	var wallets []*wallet.Wallet
+	var pubKeys [][]byte
+	for i := 0; i < n; i++ {
+		w := wallet.NewWallet(wallet.P256)
+		wallets = append(wallets, w)
+		pubKeys = append(pubKeys, w.PublicKey)
+	}
+
+	redeemScript, err := MultisigScript(m, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevOut := NewTxOutput(2*Coin, string(wallet.MultisigAddress(redeemScript)))
+
+	tx := Transaction{
+		Inputs:  []TxInput{{Id: bytes.Repeat([]byte{1}, 32), Out: 0, Sequence: MaxSequence}},
+		Outputs: []TxOutput{*NewTxOutput(Coin, testAddress(4))},
+	}
+	tx.SetID()
+
+	return wallets, &PartialTransaction{
+		Tx:           tx,
+		PrevOutputs:  []TxOutput{*prevOut},
+		RedeemScript: redeemScript,
+		Signatures:   []map[string][]byte{{}},
+	}
+}
+
+func TestPartialTransactionSignatures(t *testing.T) {
+	wallets, pt := testMultisigSpend(t, 2, 3)
+
+	if err := pt.Sign(*wallets[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pt.Complete(); err == nil {
+		t.Fatal("spend with 1 of 2 signatures was completed")
+	}
+	if err := pt.Sign(*wallet.NewWallet(wallet.P256)); err == nil {
+		t.Fatal("key outside the address signed")
+	}
+
+	// Every signer gets the spend from a file.
+	decoded, err := DeserializePartialTransaction(pt.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Sign(*wallets[2]); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.SignatureCount(); got != 2 {
+		t.Fatalf("signature count = %d, want 2", got)
+	}
+
+	tx, err := decoded.Complete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.VerifyInput(0, decoded.PrevOutputs[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeserializePartialTransactionDerivesId(t *testing.T) {
+	_, pt := testMultisigSpend(t, 2, 3)
+	id := pt.Tx.Id
+	pt.Tx.Id = bytes.Repeat([]byte{0xee}, 32)
+
+	decoded, err := DeserializePartialTransaction(pt.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Tx.Id, id) {
+		t.Fatalf("id = %x, want %x", decoded.Tx.Id, id)
+	}
+
+	data := pt.Serialize()
+	if _, err := DeserializePartialTransaction(data[:len(data)-1]); err == nil {
+		t.Error("truncated multisig transaction was accepted")
+	}
+}
+
+func TestMultisigSignerSets(t *testing.T) {
+	tests := []struct {
+		m, n    int
+		signers []int
+		ok      bool
+	}{
+		{1, 1, []int{0}, true},
+		{1, 2, []int{1}, true},
+		{2, 3, []int{0, 1}, true},
+		{2, 3, []int{0, 2}, true},
+		{2, 3, []int{2, 1}, true},
+		{2, 3, []int{1}, false},
+		{3, 3, []int{0, 1, 2}, true},
+		{3, 3, []int{0, 2}, false},
+		{2, 5, []int{4, 3}, true},
+	}
+
+	for _, test := range tests {
+		wallets, pt := testMultisigSpend(t, test.m, test.n)
+		for _, i := range test.signers {
+			if err := pt.Sign(*wallets[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tx, err := pt.Complete()
+		if test.ok && err == nil {
+			err = tx.VerifyInput(0, pt.PrevOutputs[0])
+		}
+		if test.ok && err != nil {
+			t.Errorf("%d-of-%d signed by %v: %v", test.m, test.n, test.signers, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%d-of-%d signed by %v was completed", test.m, test.n, test.signers)
+		}
+	}
+}
+
+func TestMultisigWitnesses(t *testing.T) {
+	wallets, pt := testMultisigSpend(t, 2, 3)
+	for _, w := range wallets {
+		if err := pt.Sign(*w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The signatures in the order of the sorted keys of the script.
+	_, pubKeys, err := ParseMultisigScript(pt.RedeemScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signatures [][]byte
+	for _, pubKey := range pubKeys {
+		signatures = append(signatures, pt.Signatures[0][hex.EncodeToString(pubKey)])
+	}
+	other := wallet.NewWallet(wallet.P256)
+	otherRedeemScript, err := MultisigScript(1, [][]byte{other.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		witness [][]byte
+		ok      bool
+	}{
+		{"first and second key", [][]byte{signatures[0], signatures[1], pt.RedeemScript}, true},
+		{"first and third key", [][]byte{signatures[0], signatures[2], pt.RedeemScript}, true},
+		{"keys out of order", [][]byte{signatures[1], signatures[0], pt.RedeemScript}, false},
+		{"same signature twice", [][]byte{signatures[0], signatures[0], pt.RedeemScript}, false},
+		{"empty signature", [][]byte{{}, signatures[1], pt.RedeemScript}, false},
+		{"one signature", [][]byte{signatures[0], pt.RedeemScript}, false},
+		{"no redeem script", [][]byte{signatures[0], signatures[1]}, false},
+		{"other redeem script", [][]byte{signatures[0], otherRedeemScript}, false},
+	}
+
+	for _, test := range tests {
+		tx := pt.Tx
+		tx.Inputs = []TxInput{tx.Inputs[0]}
+		tx.Inputs[0].Witness = test.witness
+
+		err := tx.VerifyInput(0, pt.PrevOutputs[0])
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: witness was accepted", test.name)
+		}
+	}
+}
+
+func TestMultisigScriptLimits(t *testing.T) {
+	key := func(i int) []byte { return append([]byte{2}, bytes.Repeat([]byte{byte(i)}, 32)...) }
+	keys := func(n int) [][]byte {
+		var pubKeys [][]byte
+		for i := 0; i < n; i++ {
+			pubKeys = append(pubKeys, key(i))
+		}
+		return pubKeys
+	}
+
+	tests := []struct {
+		m, n int
+		ok   bool
+	}{
+		{1, 1, true},
+		{15, 15, true},
+		{0, 2, false},
+		{3, 2, false},
+		{1, 0, false},
+		{1, MaxMultisigKeys + 1, false},
+	}
+
+	for _, test := range tests {
+		script, err := MultisigScript(test.m, keys(test.n))
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%d-of-%d script was built", test.m, test.n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d-of-%d: %v", test.m, test.n, err)
+			continue
+		}
+
+		m, pubKeys, err := ParseMultisigScript(script)
+		if err != nil || m != test.m || len(pubKeys) != test.n {
+			t.Errorf("%d-of-%d script parsed as %d-of-%d, %v", test.m, test.n, m, len(pubKeys), err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+const (
+	MaxOrphanTransactions = 100
+	MaxOrphanBlocks       = 50
+	OrphanExpiry          = 20 * time.Minute
+)
+
+var orphanPrefix = []byte("orphan/")
+
+// MissingParentsError is returned for a transaction or block that was kept
+// as an orphan because what it builds on is not known yet.
+type MissingParentsError struct {
+	What    string
+	Id      []byte
+	Parents [][]byte
+}
+
+func (e *MissingParentsError) Error() string {
+	var parents []string
+	for _, parent := range e.Parents {
+		parents = append(parents, hex.EncodeToString(parent))
+	}
+
+	return fmt.Sprintf("%s %x is kept as an orphan until %s arrives", e.What, e.Id, strings.Join(parents, ", "))
+}
+
+type orphan struct {
+	id      string
+	value   interface{}
+	parents []string
+	time    int64
+}
+
+// orphanPool keeps transactions or blocks until their parents arrive. It
+// holds at most max orphans, dropping the oldest to make room.
+type orphanPool struct {
+	max     int
+	orphans map[string]*orphan
+	waiting map[string]map[string]*orphan
+}
+
+func newOrphanPool(max int) *orphanPool {
+	return &orphanPool{max, make(map[string]*orphan), make(map[string]map[string]*orphan)}
+}
+
+// add returns the orphans dropped to make room for o.
+func (p *orphanPool) add(o *orphan) []*orphan {
+	if _, ok := p.orphans[o.id]; ok {
+		return nil
+	}
+
+	var dropped []*orphan
+	for len(p.orphans) >= p.max {
+		dropped = append(dropped, p.remove(p.sorted()[0].id))
+	}
+
+	p.orphans[o.id] = o
+	for _, parent := range o.parents {
+		if p.waiting[parent] == nil {
+			p.waiting[parent] = make(map[string]*orphan)
+		}
+		p.waiting[parent][o.id] = o
+	}
+
+	return dropped
+}
+
+func (p *orphanPool) remove(id string) *orphan {
+	o, ok := p.orphans[id]
+	if !ok {
+		return nil
+	}
+
+	delete(p.orphans, id)
+	for _, parent := range o.parents {
+		delete(p.waiting[parent], id)
+		if len(p.waiting[parent]) == 0 {
+			delete(p.waiting, parent)
+		}
+	}
+
+	return o
+}
+
+// expire drops the orphans that waited longer than OrphanExpiry.
+func (p *orphanPool) expire(now int64) []*orphan {
+	var expired []*orphan
+
+	for _, o := range p.sorted() {
+		if now-o.time > int64(OrphanExpiry/time.Second) {
+			expired = append(expired, p.remove(o.id))
+		}
+	}
+
+	return expired
+}
+
+// takeWaiting removes and returns the orphans waiting for parent, oldest
+// first.
+func (p *orphanPool) takeWaiting(parent string) []*orphan {
+	var taken []*orphan
+
+	for _, o := range p.sorted() {
+		if _, ok := p.waiting[parent][o.id]; ok {
+			taken = append(taken, p.remove(o.id))
+		}
+	}
+
+	return taken
+}
+
+func (p *orphanPool) sorted() []*orphan {
+	var sorted []*orphan
+
+	for _, o := range p.orphans {
+		sorted = append(sorted, o)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].time != sorted[j].time {
+			return sorted[i].time < sorted[j].time
+		}
+		return sorted[i].id < sorted[j].id
+	})
+
+	return sorted
+}
+
+// missingParents lists the transactions tx spends from that are neither in
+// the pool nor in the chain.
+func (pool *Mempool) missingParents(tx *Transaction) [][]byte {
+	var missing [][]byte
+	seen := make(map[string]bool)
+
+	for _, in := range tx.Inputs {
+		id := hex.EncodeToString(in.Id)
+		if _, ok := pool.entries[id]; ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if _, err := pool.chain.FindTransaction(in.Id); err != nil {
+			missing = append(missing, in.Id)
+		}
+	}
+
+	return missing
+}
+
+// accept adds tx to the pool in place of the entries it replaces, or to the
+// orphans when its parents are missing.
+func (pool *Mempool) accept(tx *Transaction) (*MempoolEntry, error) {
+	entry, replaced, err := pool.validate(tx)
+
+	if missing, ok := err.(*MissingParentsError); ok {
+		var parents []string
+		for _, parent := range missing.Parents {
+			parents = append(parents, hex.EncodeToString(parent))
+		}
+
+		o := &orphan{hex.EncodeToString(tx.Id), tx, parents, time.Now().Unix()}
+		dropped := pool.orphans.add(o)
+		if saveErr := pool.saveOrphans([]*orphan{o}, dropped); saveErr != nil {
+			return nil, saveErr
+		}
+
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range replaced {
+		pool.remove(e)
+	}
+	pool.entries[hex.EncodeToString(tx.Id)] = entry
+	pool.link(entry)
+
+	return entry, pool.save([]*MempoolEntry{entry}, replaced)
+}
+
+// acceptOrphans retries the orphans waiting for the transactions ids, and
+// in turn those waiting for the orphans that get accepted.
+func (pool *Mempool) acceptOrphans(ids [][]byte) error {
+	for len(ids) > 0 {
+		waiting := pool.orphans.takeWaiting(hex.EncodeToString(ids[0]))
+		ids = ids[1:]
+
+		if err := pool.saveOrphans(nil, waiting); err != nil {
+			return err
+		}
+
+		for _, o := range waiting {
+			tx := o.value.(*Transaction)
+			if _, err := pool.accept(tx); err == nil {
+				ids = append(ids, tx.Id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pool *Mempool) expireOrphans() error {
+	return pool.saveOrphans(nil, pool.orphans.expire(time.Now().Unix()))
+}
+
+// OrphanCount is the number of transactions waiting for their parents.
+func (pool *Mempool) OrphanCount() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return len(pool.orphans.orphans)
+}
+
+func (pool *Mempool) loadOrphans(txn *badger.Txn) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = orphanPrefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		data, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		d := newDecoder(data)
+		o := d.orphanTransaction()
+		if err := d.Finish("orphan"); err != nil {
+			return fmt.Errorf("invalid orphan %x: %v", it.Item().Key()[len(orphanPrefix):], err)
+		}
+		pool.orphans.add(o)
+	}
+
+	return nil
+}
+
+func (pool *Mempool) saveOrphans(added, removed []*orphan) error {
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	return pool.chain.Database.Update(func(txn *badger.Txn) error {
+		for _, o := range removed {
+			if err := txn.Delete(orphanKey(o.value.(*Transaction).Id)); err != nil {
+				return err
+			}
+		}
+		for _, o := range added {
+			var e encoder
+			e.putOrphanTransaction(o)
+			if err := txn.Set(orphanKey(o.value.(*Transaction).Id), e.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func orphanKey(id []byte) []byte {
+	return append(append([]byte{}, orphanPrefix...), id...)
+}
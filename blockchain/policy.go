@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ScriptClass names the kinds of locking scripts a node relays by default.
+type ScriptClass int
+
+const (
+	NonStandardScript ScriptClass = iota
+	PubKeyHashScript
+	ScriptHashScript
+	MultisigScriptClass
+	HTLCScript
+	DataCarrierScript
+)
+
+var scriptClassNames = []string{"nonstandard", "pubkeyhash", "scripthash", "multisig", "htlc", "datacarrier"}
+
+func (c ScriptClass) String() string {
+	return scriptClassNames[c]
+}
+
+func (s Script) Class() ScriptClass {
+	switch {
+	case s.IsP2PKH(), s.IsEd25519PKH():
+		return PubKeyHashScript
+	case s.IsP2SH():
+		return ScriptHashScript
+	case s.IsDataCarrier():
+		return DataCarrierScript
+	}
+	if _, _, err := ParseMultisigScript(s); err == nil {
+		return MultisigScriptClass
+	}
+	if _, err := ParseHTLCScript(s); err == nil {
+		return HTLCScript
+	}
+
+	return NonStandardScript
+}
+
+// Policy holds the rules a node applies on top of consensus before it
+// relays or mines a transaction. Blocks are not held to them.
+type Policy struct {
+	// AcceptNonStandard turns the standardness checks off.
+	AcceptNonStandard bool `json:"acceptnonstandard"`
+	// DustRelayFee makes an output dust when spending it would cost more
+	// than its value at this rate.
+	DustRelayFee       FeeRate `json:"dustrelayfee"`
+	MaxDataCarrierSize int     `json:"datacarriersize"`
+	MaxInputs          int     `json:"maxinputs"`
+	MaxTxSize          int     `json:"maxtxsize"`
+	MaxWitnessItems    int     `json:"maxwitnessitems"`
+	// MaxWitnessItemSize limits the witness items other than the redeem
+	// script ending the witness of a P2SH spend.
+	MaxWitnessItemSize int `json:"maxwitnessitemsize"`
+
+	// MinRelayFee is the least fee rate the pool takes while it has room.
+	MinRelayFee FeeRate `json:"minrelayfee"`
+	// MaxMempoolSize limits the bytes of the pool transactions.
+	MaxMempoolSize int `json:"maxmempool"`
+	// MempoolExpiry is the number of hours a transaction stays in the pool
+	// without being mined.
+	MempoolExpiry int `json:"mempoolexpiry"`
+}
+
+var DefaultPolicy = Policy{
+	DustRelayFee:       3000,
+	MaxDataCarrierSize: MaxDataCarrierSize,
+	MaxInputs:          500,
+	MaxTxSize:          100000,
+	MaxWitnessItems:    100,
+	MaxWitnessItemSize: 80,
+	MinRelayFee:        1000,
+	MaxMempoolSize:     50000000,
+	MempoolExpiry:      336,
+}
+
+// PolicyError is a transaction refused for breaking a Policy rule.
+type PolicyError struct {
+	Id     []byte
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("transaction %x is not standard: %s", e.Id, e.Reason)
+}
+
+// LoadPolicy reads the rules of a node from a JSON file, taking those the
+// file leaves out from DefaultPolicy. A missing file gives DefaultPolicy.
+func LoadPolicy(file string) (Policy, error) {
+	policy := DefaultPolicy
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, err
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("invalid policy file %s: %v", file, err)
+	}
+
+	return policy, policy.validate()
+}
+
+func (p Policy) Save(file string) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, append(data, '\n'), 0600)
+}
+
+func (p Policy) validate() error {
+	if p.MaxDataCarrierSize < 0 || p.MaxDataCarrierSize > MaxDataCarrierSize {
+		return fmt.Errorf("data carrier size %d is not between 0 and %d", p.MaxDataCarrierSize, MaxDataCarrierSize)
+	}
+	if p.MaxInputs < 1 {
+		return fmt.Errorf("at least one input has to be allowed")
+	}
+	if p.MaxTxSize < 1 || p.MaxTxSize > MaxBlockSize {
+		return fmt.Errorf("transaction size %d is not between 1 and %d", p.MaxTxSize, MaxBlockSize)
+	}
+	if p.MaxWitnessItems < 0 {
+		return fmt.Errorf("witness item count %d is negative", p.MaxWitnessItems)
+	}
+	if p.MaxWitnessItemSize < 0 {
+		return fmt.Errorf("witness item size %d is negative", p.MaxWitnessItemSize)
+	}
+	if p.MaxMempoolSize < p.MaxTxSize {
+		return fmt.Errorf("memory pool size %d is smaller than the transaction size %d", p.MaxMempoolSize, p.MaxTxSize)
+	}
+	if p.MempoolExpiry < 1 {
+		return fmt.Errorf("memory pool expiry has to be at least an hour")
+	}
+
+	return nil
+}
+
+// DustThreshold is the least value out can carry without being dust: the
+// fee, at DustRelayFee, of the output and of the input that spends it.
+func (p Policy) DustThreshold(out TxOutput) Amount {
+	if out.Script.IsUnspendable() {
+		return 0
+	}
+
+	outputSize := 8 + 4 + len(out.Script)
+	inputSize := 4 + 32 + 4 + 4 + 4 + estimatedWitnessSize
+
+	return p.DustRelayFee.Fee(outputSize + inputSize)
+}
+
+func (p Policy) IsDust(out TxOutput) bool {
+	return out.Value < p.DustThreshold(out)
+}
+
+// CheckTransaction returns a *PolicyError for a transaction the node
+// should neither relay nor mine.
+func (p Policy) CheckTransaction(tx *Transaction) error {
+	if p.AcceptNonStandard {
+		return nil
+	}
+
+	reject := func(format string, args ...interface{}) error {
+		return &PolicyError{tx.Id, fmt.Sprintf(format, args...)}
+	}
+
+	if size := tx.Size(); size > p.MaxTxSize {
+		return reject("size of %d bytes exceeds %d", size, p.MaxTxSize)
+	}
+	if len(tx.Inputs) > p.MaxInputs {
+		return reject("%d inputs exceed %d", len(tx.Inputs), p.MaxInputs)
+	}
+
+	for inId, in := range tx.Inputs {
+		if len(in.Witness) > p.MaxWitnessItems {
+			return reject("input %d witness of %d items exceeds %d", inId, len(in.Witness), p.MaxWitnessItems)
+		}
+	}
+
+	dataOutputs := 0
+	for outId, out := range tx.Outputs {
+		switch out.Script.Class() {
+		case NonStandardScript:
+			return reject("output %d has a nonstandard script", outId)
+		case DataCarrierScript:
+			dataOutputs++
+			if size := len(out.Script.DataPayload()); size > p.MaxDataCarrierSize {
+				return reject("data output %d of %d bytes exceeds %d", outId, size, p.MaxDataCarrierSize)
+			}
+			continue
+		}
+
+		if threshold := p.DustThreshold(out); out.Value < threshold {
+			return reject("output %d of %s is dust, below %s", outId, out.Value, threshold)
+		}
+	}
+	if dataOutputs > 1 {
+		return reject("%d data outputs, only one is allowed", dataOutputs)
+	}
+
+	return nil
+}
+
+// CheckWitnesses returns a *PolicyError for a transaction with a witness
+// item over MaxWitnessItemSize. The redeem script a P2SH spend ends with,
+// found through the outputs in prevTxs, is held only to consensus.
+func (p Policy) CheckWitnesses(tx *Transaction, prevTxs map[string]Transaction) error {
+	if p.AcceptNonStandard {
+		return nil
+	}
+
+	for inId, in := range tx.Inputs {
+		items := in.Witness
+		prevTx := prevTxs[hex.EncodeToString(in.Id)]
+		if in.Out >= 0 && in.Out < len(prevTx.Outputs) && prevTx.Outputs[in.Out].Script.IsP2SH() && len(items) > 0 {
+			items = items[:len(items)-1]
+		}
+
+		for i, item := range items {
+			if len(item) > p.MaxWitnessItemSize {
+				return &PolicyError{tx.Id, fmt.Sprintf("input %d witness item %d of %d bytes exceeds %d", inId, i, len(item), p.MaxWitnessItemSize)}
+			}
+		}
+	}
+
+	return nil
+}
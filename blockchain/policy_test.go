@@ -0,0 +1,52 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestPolicyWitnessLimits(t *testing.T) {
+	p2sh := P2SHScript(bytes.Repeat([]byte{1}, publicKeyHashLength))
+	p2pkh := NewTxOutput(Coin, testAddress(1)).Script
+
+	item := func(size int) []byte { return bytes.Repeat([]byte{2}, size) }
+
+	tests := []struct {
+		name    string
+		lock    Script
+		witness [][]byte
+		ok      bool
+	}{
+		{"signature and key", p2pkh, [][]byte{item(72), item(33)}, true},
+		{"item at the limit", p2pkh, [][]byte{item(80)}, true},
+		{"item over the limit", p2pkh, [][]byte{item(72), item(81)}, false},
+		{"too many items", p2pkh, make([][]byte, 101), false},
+		{"large redeem script", p2sh, [][]byte{item(72), item(500)}, true},
+		{"large item before the redeem script", p2sh, [][]byte{item(81), item(500)}, false},
+	}
+
+	for _, test := range tests {
+		prevTx := &Transaction{Outputs: []TxOutput{{Value: Coin, Script: test.lock}}}
+		prevTx.SetID()
+
+		tx := &Transaction{
+			Inputs:  []TxInput{{Id: prevTx.Id, Out: 0, Sequence: MaxSequence, Witness: test.witness}},
+			Outputs: []TxOutput{*NewTxOutput(Coin/2, testAddress(2))},
+		}
+		tx.SetID()
+
+		err := DefaultPolicy.CheckTransaction(tx)
+		if err == nil {
+			err = DefaultPolicy.CheckWitnesses(tx, map[string]Transaction{hex.EncodeToString(prevTx.Id): *prevTx})
+		}
+
+		var policyErr *PolicyError
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && !errors.As(err, &policyErr) {
+			t.Errorf("%s: got %v, want a policy error", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// MaxFutureBlockTime is how far ahead of the local clock a block timestamp
+// may be.
+const MaxFutureBlockTime = 2 * time.Hour
+
+// ProcessBlock adds a block mined elsewhere to the chain. A block whose
+// parent is unknown is kept as an orphan, returning a *MissingParentsError,
+// and added once the parent arrives. A block on a branch other than that of
+// the last block is stored, and the chain switches to that branch when it
+// has more work. ProcessBlock returns every block it connected to the
+// chain, orphans and the blocks of a new branch included.
+func (chain *BlockChain) ProcessBlock(block *Block) ([]*Block, error) {
+	chain.orphans.expire(time.Now().Unix())
+
+	if _, err := chain.GetBlock(block.Hash); err == nil {
+		return nil, fmt.Errorf("block %x is already known", block.Hash)
+	}
+	if err := checkProofOfWork(block); err != nil {
+		return nil, err
+	}
+	if len(block.PrevHash) == 0 {
+		return nil, fmt.Errorf("block %x is the genesis block of another chain", block.Hash)
+	}
+
+	if _, err := chain.GetBlock(block.PrevHash); err != nil {
+		o := &orphan{hex.EncodeToString(block.Hash), block, []string{hex.EncodeToString(block.PrevHash)}, time.Now().Unix()}
+		chain.orphans.add(o)
+
+		return nil, &MissingParentsError{"block", block.Hash, [][]byte{block.PrevHash}}
+	}
+
+	connected, err := chain.acceptBlock(block)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := []*Block{block}
+	for i := 0; i < len(stored); i++ {
+		for _, o := range chain.orphans.takeWaiting(hex.EncodeToString(stored[i].Hash)) {
+			orphanBlock := o.value.(*Block)
+			if blocks, err := chain.acceptBlock(orphanBlock); err == nil {
+				stored = append(stored, orphanBlock)
+				connected = append(connected, blocks...)
+			}
+		}
+	}
+
+	return connected, nil
+}
+
+// OrphanBlockCount is the number of blocks waiting for their parents.
+func (chain *BlockChain) OrphanBlockCount() int {
+	return len(chain.orphans.orphans)
+}
+
+// acceptBlock adds a block whose parent is stored. A block on top of the
+// last block is connected, one on another branch is stored and connected
+// with its branch once that has more work than the chain.
+func (chain *BlockChain) acceptBlock(block *Block) ([]*Block, error) {
+	if chain.isInvalid(block.PrevHash) {
+		if err := chain.markInvalid(block.Hash); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("block %x builds on an invalid block %x", block.Hash, block.PrevHash)
+	}
+
+	if bytes.Equal(block.PrevHash, chain.LastHash) {
+		if err := chain.connectBlock(block); err != nil {
+			return nil, err
+		}
+		return []*Block{block}, nil
+	}
+
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := chain.checkBlockHeader(block, parent); err != nil {
+		return nil, err
+	}
+	if err := chain.storeSideBlock(block); err != nil {
+		return nil, err
+	}
+
+	work, err := chain.ChainWork(block.Hash)
+	if err != nil {
+		return nil, err
+	}
+	lastWork, err := chain.ChainWork(chain.LastHash)
+	if err != nil {
+		return nil, err
+	}
+	if work.Cmp(lastWork) <= 0 {
+		return nil, nil
+	}
+
+	return chain.reorganize(block)
+}
+
+func (chain *BlockChain) connectBlock(block *Block) error {
+	if !bytes.Equal(block.PrevHash, chain.LastHash) {
+		return fmt.Errorf("block %x does not extend the last block %x", block.Hash, chain.LastHash)
+	}
+
+	lastBlock, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return err
+	}
+	medianTime, err := chain.checkBlockHeader(block, lastBlock)
+	if err != nil {
+		return err
+	}
+
+	if err := chain.checkBlockTransactions(block.Transactions, block.Height, medianTime); err != nil {
+		return fmt.Errorf("block %x: %v", block.Hash, err)
+	}
+
+	return chain.storeBlock(block)
+}
+
+// checkBlockHeader checks the height and timestamp of block against its
+// parent, and returns the median time past of the parent.
+func (chain *BlockChain) checkBlockHeader(block, parent *Block) (int64, error) {
+	if block.Height != parent.Height+1 {
+		return 0, fmt.Errorf("block %x has height %d instead of %d", block.Hash, block.Height, parent.Height+1)
+	}
+
+	medianTime := chain.MedianTimePast(parent.Hash)
+	if int64(block.Timestamp) < medianTime {
+		return 0, fmt.Errorf("block %x has a timestamp before the median time %d", block.Hash, medianTime)
+	}
+	if int64(block.Timestamp) > time.Now().Add(MaxFutureBlockTime).Unix() {
+		return 0, fmt.Errorf("block %x has a timestamp too far in the future", block.Hash)
+	}
+
+	return medianTime, nil
+}
+
+func checkProofOfWork(block *Block) error {
+	pow := NewProof(block)
+	hash := sha256.Sum256(pow.InitData(block.Nonce))
+
+	if !bytes.Equal(hash[:], block.Hash) || new(big.Int).SetBytes(hash[:]).Cmp(pow.Target) >= 0 {
+		return fmt.Errorf("block %x has an invalid proof of work", block.Hash)
+	}
+
+	return nil
+}
@@ -27,10 +27,19 @@ func NewProof(b *Block) *ProofOfWork {
 }
 
 func (pow *ProofOfWork) InitData(nonce int) []byte {
+	return pow.initData(pow.Block.HashTransaction(), pow.Block.HashWitnesses(), nonce)
+}
+
+// initData is InitData with the transaction and witness hashes, which stay
+// the same for every nonce, computed once by the caller.
+func (pow *ProofOfWork) initData(txHash, witnessHash []byte, nonce int) []byte {
 	data := bytes.Join(
 		[][]byte{
 			pow.Block.PrevHash,
-			pow.Block.HashTransaction(),
+			txHash,
+			witnessHash,
+			ToHex(int64(pow.Block.Timestamp)),
+			ToHex(int64(pow.Block.Height)),
 			ToHex(int64(nonce)),
 			ToHex(int64(Difficulty)),
 		},
@@ -44,9 +53,10 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	var hash [32]byte
 
 	nonce := 0
+	txHash, witnessHash := pow.Block.HashTransaction(), pow.Block.HashWitnesses()
 
 	for nonce < math.MaxInt64 {
-		data := pow.InitData(nonce)
+		data := pow.initData(txHash, witnessHash, nonce)
 		hash = sha256.Sum256(data)
 
 		fmt.Printf("\r%s (%x)", time.Unix(int64(pow.Block.Timestamp), 0), hash)
@@ -72,3 +82,11 @@ func (pow *ProofOfWork) Validate() bool {
 
 	return intHash.Cmp(pow.Target) == -1
 }
+
+// Work is the number of hashes it takes on average to find a proof below
+// the target.
+func (pow *ProofOfWork) Work() *big.Int {
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return work.Div(work, new(big.Int).Add(pow.Target, big.NewInt(1)))
+}
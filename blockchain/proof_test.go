@@ -0,0 +1,23 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProofCommitsToWitnesses(t *testing.T) {
+	block := testBlock()
+	block.Mine()
+
+	if err := checkProofOfWork(block); err != nil {
+		t.Fatal(err)
+	}
+	if !NewProof(block).Validate() {
+		t.Fatal("mined block does not validate")
+	}
+
+	block.Transactions[1].Inputs[0].Witness[0] = bytes.Repeat([]byte{9}, 64)
+	if err := checkProofOfWork(block); err == nil {
+		t.Error("proof still holds after a witness changed")
+	}
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// RawTransaction is a transaction passed by hand between createrawtx,
+// signrawtx and submitrawtx. It carries the outputs its inputs spend, in
+// input order, so that it can be signed without the chain.
+type RawTransaction struct {
+	Tx          Transaction
+	PrevOutputs []TxOutput
+}
+
+// NewRawTransactionFromView builds a raw transaction like NewRawTransaction
+// and looks up the outputs its inputs spend in view.
+func NewRawTransactionFromView(inputs []TxInput, outputs []TxOutput, view UTXOView, options SendOptions) (*RawTransaction, error) {
+	tx, err := NewRawTransaction(inputs, outputs, options)
+	if err != nil {
+		return nil, err
+	}
+
+	prevTxs, err := view.PreviousTransactions(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := RawTransaction{Tx: *tx}
+	for inId, in := range tx.Inputs {
+		prevTx := prevTxs[hex.EncodeToString(in.Id)]
+		if in.Out >= len(prevTx.Outputs) {
+			return nil, fmt.Errorf("input %d spends missing output %x:%d", inId, in.Id, in.Out)
+		}
+		rt.PrevOutputs = append(rt.PrevOutputs, prevTx.Outputs[in.Out])
+	}
+
+	return &rt, nil
+}
+
+// PreviousTransactions stands in for the transactions the inputs spend, as
+// Sign and SignWithWalletDB expect them. Only the spent outputs are filled.
+func (rt *RawTransaction) PreviousTransactions() map[string]Transaction {
+	prevTxs := make(map[string]Transaction)
+
+	for inId, in := range rt.Tx.Inputs {
+		if in.Out < 0 {
+			continue
+		}
+		prevTx := prevTxs[hex.EncodeToString(in.Id)]
+		for len(prevTx.Outputs) <= in.Out {
+			prevTx.Outputs = append(prevTx.Outputs, TxOutput{})
+		}
+		prevTx.Id = in.Id
+		prevTx.Outputs[in.Out] = rt.PrevOutputs[inId]
+		prevTxs[hex.EncodeToString(in.Id)] = prevTx
+	}
+
+	return prevTxs
+}
+
+// Fee is the value of the spent outputs not paid out again. It fails when
+// the outputs pay more than the inputs, or either sum overflows.
+func (rt *RawTransaction) Fee() (Amount, error) {
+	var in, out Amount
+	var err error
+
+	for inId, prevOut := range rt.PrevOutputs {
+		if in, err = in.Add(prevOut.Value); err != nil {
+			return 0, fmt.Errorf("input %d: %v", inId, err)
+		}
+	}
+	for outId, txOut := range rt.Tx.Outputs {
+		if out, err = out.Add(txOut.Value); err != nil {
+			return 0, fmt.Errorf("output %d: %v", outId, err)
+		}
+	}
+
+	fee, err := in.Sub(out)
+	if err != nil {
+		return 0, fmt.Errorf("outputs of %s exceed the inputs of %s", out, in)
+	}
+
+	return fee, nil
+}
+
+func (rt *RawTransaction) Serialize() []byte {
+	var e encoder
+	e.putRawTransaction(rt)
+
+	return e.Bytes()
+}
+
+func DeserializeRawTransaction(data []byte) (*RawTransaction, error) {
+	d := newDecoder(data)
+	rt := d.rawTransaction()
+	if err := d.Finish("raw transaction"); err != nil {
+		return nil, fmt.Errorf("invalid raw transaction: %v", err)
+	}
+
+	return rt, nil
+}
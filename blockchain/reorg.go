@@ -0,0 +1,183 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	badger "github.com/dgraph-io/badger/v3"
+)
+
+var (
+	workPrefix    = []byte("work/")
+	invalidPrefix = []byte("invalid/")
+)
+
+func blockKey(prefix, hash []byte) []byte {
+	return append(append([]byte{}, prefix...), hash...)
+}
+
+// ChainWork is the work of the block with hash and of all blocks before it.
+// Blocks stored before the work was tracked are summed up again.
+func (chain *BlockChain) ChainWork(hash []byte) (*big.Int, error) {
+	var blocks []*Block
+	work := new(big.Int)
+
+	for len(hash) != 0 {
+		stored, err := chain.storedWork(hash)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			work = stored
+			break
+		}
+
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+		hash = block.PrevHash
+	}
+
+	for _, block := range blocks {
+		work.Add(work, NewProof(block).Work())
+	}
+
+	return work, nil
+}
+
+func (chain *BlockChain) storedWork(hash []byte) (*big.Int, error) {
+	var work *big.Int
+
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(blockKey(workPrefix, hash))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(data []byte) error {
+			work = new(big.Int).SetBytes(data)
+			return nil
+		})
+	})
+
+	return work, err
+}
+
+// putBlock saves block together with the work of its branch.
+func (chain *BlockChain) putBlock(txn *badger.Txn, block *Block) error {
+	work, err := chain.ChainWork(block.PrevHash)
+	if err != nil {
+		return err
+	}
+	work.Add(work, NewProof(block).Work())
+
+	if err := txn.Set(block.Hash, block.Serialize()); err != nil {
+		return err
+	}
+
+	return txn.Set(blockKey(workPrefix, block.Hash), work.Bytes())
+}
+
+// storeSideBlock saves a block that is not on the chain.
+func (chain *BlockChain) storeSideBlock(block *Block) error {
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		return chain.putBlock(txn, block)
+	})
+}
+
+func (chain *BlockChain) setLastHash(hash []byte) error {
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(lastHashByte, hash); err != nil {
+			return err
+		}
+		chain.LastHash = hash
+
+		return nil
+	})
+}
+
+func (chain *BlockChain) isInvalid(hash []byte) bool {
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(blockKey(invalidPrefix, hash))
+		return err
+	})
+
+	return err == nil
+}
+
+func (chain *BlockChain) markInvalid(hash []byte) error {
+	return chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Set(blockKey(invalidPrefix, hash), nil)
+	})
+}
+
+// branches walks back from the blocks from and to until they meet. It
+// returns the blocks only on the branch of from, newest first, and those
+// only on the branch of to, oldest first.
+func (chain *BlockChain) branches(from, to []byte) ([]*Block, []*Block, error) {
+	var detached, attached []*Block
+
+	a, err := chain.GetBlock(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := chain.GetBlock(to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for !bytes.Equal(a.Hash, b.Hash) {
+		if a.Height >= b.Height {
+			detached = append(detached, a)
+			a, err = chain.GetBlock(a.PrevHash)
+		} else {
+			attached = append([]*Block{b}, attached...)
+			b, err = chain.GetBlock(b.PrevHash)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("blocks %x and %x share no ancestor: %v", from, to, err)
+		}
+	}
+
+	return detached, attached, nil
+}
+
+// reorganize switches the chain to the branch of tip, which has more work
+// than the last block. The blocks of the branch are connected from the
+// last block the two share on. When one turns out invalid, it is marked
+// so together with the blocks after it, and the chain goes back to its
+// last block, whose branch stays stored.
+func (chain *BlockChain) reorganize(tip *Block) ([]*Block, error) {
+	lastHash := chain.LastHash
+
+	_, attached, err := chain.branches(lastHash, tip.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.setLastHash(attached[0].PrevHash); err != nil {
+		return nil, err
+	}
+
+	for i, block := range attached {
+		if err := chain.connectBlock(block); err != nil {
+			for _, invalid := range attached[i:] {
+				if markErr := chain.markInvalid(invalid.Hash); markErr != nil {
+					return nil, markErr
+				}
+			}
+			if restoreErr := chain.setLastHash(lastHash); restoreErr != nil {
+				return nil, restoreErr
+			}
+
+			return nil, err
+		}
+	}
+
+	return attached, nil
+}
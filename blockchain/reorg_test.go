@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// testChain starts a chain paying its genesis block to address in a
+// temporary working directory.
+func testChain(t *testing.T, address string) *BlockChain {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := InitBlockChain(false, address)
+	t.Cleanup(func() {
+		chain.Close()
+		os.Chdir(dir)
+	})
+
+	return chain
+}
+
+// mineOn mines a block with a coinbase to a test address and txs on top of
+// parent.
+func mineOn(parent *Block, txs ...*Transaction) *Block {
+	coinbase := CoinbaseTx(testAddress(9), fmt.Sprintf("block %d after %x", parent.Height+1, parent.Hash))
+
+	return NewBlock(append([]*Transaction{coinbase}, txs...), parent.Hash, parent.Height+1)
+}
+
+func TestProcessBlockReorganizes(t *testing.T) {
+	chain, pool, tx := testPoolSpend(t, Coin)
+	if _, err := pool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a1 := mineOn(genesis, tx)
+	if _, err := chain.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pool.Entry(tx.Id); ok {
+		t.Fatal("mined transaction is still in the pool")
+	}
+
+	// A branch of equal work is only stored.
+	b1 := mineOn(genesis)
+	connected, err := chain.ProcessBlock(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connected) != 0 || !bytes.Equal(chain.LastHash, a1.Hash) {
+		t.Fatal("the chain switched to a branch without more work")
+	}
+
+	b2 := mineOn(b1)
+	connected, err = chain.ProcessBlock(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(connected) != 2 || !bytes.Equal(connected[0].Hash, b1.Hash) || !bytes.Equal(connected[1].Hash, b2.Hash) {
+		t.Fatalf("connected %d blocks, want the 2 of the new branch", len(connected))
+	}
+	if !bytes.Equal(chain.LastHash, b2.Hash) {
+		t.Fatalf("last block %x, want %x", chain.LastHash, b2.Hash)
+	}
+	if _, err := chain.FindTransaction(tx.Id); err == nil {
+		t.Error("transaction of the old branch is still in the chain")
+	}
+
+	if err := pool.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pool.Entry(tx.Id); !ok {
+		t.Error("transaction of the old branch did not return to the pool")
+	}
+
+	// The old branch takes over again once it has more work, with the
+	// transaction mined again.
+	a2 := mineOn(a1)
+	a3 := mineOn(a2)
+	for _, block := range []*Block{a2, a3} {
+		if _, err := chain.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(chain.LastHash, a3.Hash) {
+		t.Fatalf("last block %x, want %x", chain.LastHash, a3.Hash)
+	}
+	if err := pool.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pool.Entry(tx.Id); ok {
+		t.Error("transaction mined again is still in the pool")
+	}
+}
+
+func TestProcessBlockRejectsInvalidBranch(t *testing.T) {
+	chain := testChain(t, testAddress(1))
+
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1 := mineOn(genesis)
+	if _, err := chain.ProcessBlock(a1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The branch spends an output that does not exist, which is only
+	// noticed when the branch gets connected.
+	bad := &Transaction{
+		Inputs:  []TxInput{{Id: bytes.Repeat([]byte{7}, 32), Out: 0, Sequence: MaxSequence}},
+		Outputs: []TxOutput{*NewTxOutput(Coin, testAddress(4))},
+	}
+	bad.SetID()
+	b1 := mineOn(genesis, bad)
+	if _, err := chain.ProcessBlock(b1); err != nil {
+		t.Fatal(err)
+	}
+	b2 := mineOn(b1)
+	if _, err := chain.ProcessBlock(b2); err == nil {
+		t.Fatal("branch with an invalid block was connected")
+	}
+	if !bytes.Equal(chain.LastHash, a1.Hash) {
+		t.Fatalf("last block %x, want %x", chain.LastHash, a1.Hash)
+	}
+
+	if _, err := chain.ProcessBlock(mineOn(b2)); err == nil {
+		t.Error("block on an invalid branch was accepted")
+	}
+	if !chain.isInvalid(b1.Hash) || !chain.isInvalid(b2.Hash) {
+		t.Error("the invalid branch was not marked")
+	}
+}
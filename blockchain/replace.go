@@ -0,0 +1,193 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+const (
+	// MaxReplaceableSequence is the highest input sequence that signals a
+	// transaction can be replaced in the memory pool.
+	MaxReplaceableSequence = MaxSequence - 2
+	// IncrementalRelayFee is what a replacement pays on top of the fees of
+	// the transactions it evicts, for its own size.
+	IncrementalRelayFee FeeRate = 1000
+	MaxReplacedEntries          = 100
+)
+
+func (tx *Transaction) IsReplaceable() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence <= MaxReplaceableSequence {
+			return true
+		}
+	}
+
+	return false
+}
+
+// conflicts returns the pool entries spending the same outputs as tx, all
+// of which must signal they can be replaced.
+func (pool *Mempool) conflicts(tx *Transaction) ([]*MempoolEntry, error) {
+	var conflicts []*MempoolEntry
+	seen := make(map[*MempoolEntry]bool)
+
+	for inId, in := range tx.Inputs {
+		spender, ok := pool.spends[outpoint(in.Id, in.Out)]
+		if !ok || seen[spender] {
+			continue
+		}
+		if !spender.Tx.IsReplaceable() {
+			return nil, fmt.Errorf("input %d conflicts with transaction %x in the memory pool", inId, spender.Tx.Id)
+		}
+
+		seen[spender] = true
+		conflicts = append(conflicts, spender)
+	}
+
+	return conflicts, nil
+}
+
+// checkReplacement returns the entries that go when entry replaces
+// conflicts: those and everything spending their outputs. The replacement
+// pays a higher fee rate than each of the conflicts, and more in fees than
+// all of the evicted entries together, by IncrementalRelayFee for its size.
+func (pool *Mempool) checkReplacement(entry *MempoolEntry, conflicts []*MempoolEntry) ([]*MempoolEntry, error) {
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	var replaced []*MempoolEntry
+	var fees Amount
+	seen := make(map[*MempoolEntry]bool)
+
+	for _, conflict := range conflicts {
+		if entry.FeeRate() <= conflict.FeeRate() {
+			return nil, fmt.Errorf("transaction %x pays %s, not more than the %s of transaction %x it replaces", entry.Tx.Id, entry.FeeRate(), conflict.FeeRate(), conflict.Tx.Id)
+		}
+
+		for _, e := range append([]*MempoolEntry{conflict}, pool.descendants(conflict)...) {
+			if seen[e] {
+				continue
+			}
+			seen[e] = true
+			replaced = append(replaced, e)
+			fees = saturatingAdd(fees, e.Fee)
+		}
+	}
+
+	if len(replaced) > MaxReplacedEntries {
+		return nil, fmt.Errorf("transaction %x would replace %d transactions, more than %d", entry.Tx.Id, len(replaced), MaxReplacedEntries)
+	}
+
+	for _, in := range entry.Tx.Inputs {
+		if e, ok := pool.entries[hex.EncodeToString(in.Id)]; ok && seen[e] {
+			return nil, fmt.Errorf("transaction %x spends an output of transaction %x it replaces", entry.Tx.Id, in.Id)
+		}
+	}
+
+	needed := saturatingAdd(fees, IncrementalRelayFee.Fee(entry.Size))
+	if entry.Fee < needed {
+		return nil, fmt.Errorf("transaction %x pays %s in fees, it needs %s to replace %d transactions", entry.Tx.Id, entry.Fee, needed, len(replaced))
+	}
+
+	return replaced, nil
+}
+
+// BumpFee rebuilds the pool transaction id to pay rate, or the least rate
+// that replaces it when rate is zero. The inputs and payments stay, the fee
+// comes out of the change, and further coins of the wallet are added when
+// the change does not cover it.
+func (pool *Mempool) BumpFee(id []byte, rate FeeRate) (*Transaction, error) {
+	entry, ok := pool.Entry(id)
+	if !ok {
+		return nil, fmt.Errorf("transaction %x is not in the memory pool", id)
+	}
+	tx := entry.Tx
+	if !tx.IsReplaceable() {
+		return nil, fmt.Errorf("transaction %x does not signal it can be replaced", id)
+	}
+
+	if rate == 0 {
+		rate = entry.FeeRate() + IncrementalRelayFee
+	} else if rate <= entry.FeeRate() {
+		return nil, fmt.Errorf("fee rate %s is not above the %s transaction %x pays", rate, entry.FeeRate(), id)
+	}
+
+	evicted := append([]*MempoolEntry{entry}, pool.Descendants(entry)...)
+	var fees Amount
+	skip := make(map[string]bool)
+	for _, e := range evicted {
+		fees = saturatingAdd(fees, e.Fee)
+		skip[hex.EncodeToString(e.Tx.Id)] = true
+	}
+
+	prevTxs, err := pool.PreviousTransactions(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	walletDB, err := wallet.CreateWalletDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var required []UnspentOutput
+	var change []byte
+	owners := make(map[string]*wallet.Wallet)
+	for inId, in := range tx.Inputs {
+		out := prevTxs[hex.EncodeToString(in.Id)].Outputs[in.Out]
+		w, ok := walletDB.FindWallet(out.Script.PubKeyHash())
+		if !ok {
+			return nil, fmt.Errorf("input %d of transaction %x is not spent by a wallet key", inId, id)
+		}
+		if change == nil {
+			change = w.Address()
+		}
+
+		owners[hex.EncodeToString(out.Script.PubKeyHash())] = w
+		required = append(required, UnspentOutput{in.Id, in.Out, out})
+	}
+
+	// The change is the last output paying back to one of the inputs.
+	payments := tx.Outputs
+	for outIdx := len(tx.Outputs) - 1; outIdx >= 0; outIdx-- {
+		if w, ok := owners[hex.EncodeToString(tx.Outputs[outIdx].Script.PubKeyHash())]; ok {
+			payments = append(append([]TxOutput{}, tx.Outputs[:outIdx]...), tx.Outputs[outIdx+1:]...)
+			change = w.Address()
+			break
+		}
+	}
+
+	var utxos []UnspentOutput
+	for _, w := range owners {
+		for _, utxo := range pool.FindUnspentOutputs(wallet.PublicKeyHash(w.PublicKey)) {
+			if !skip[hex.EncodeToString(utxo.TxId)] {
+				utxos = append(utxos, utxo)
+			}
+		}
+	}
+
+	options := SendOptions{LockTime: tx.LockTime, Replaceable: true}
+	bumped, err := fundTransaction(required, utxos, payments, string(change), options, estimatedWitnessSize, func(size int) Amount {
+		fee := rate.Fee(size)
+		if least := saturatingAdd(fees, IncrementalRelayFee.Fee(size)); least > fee {
+			return least
+		}
+		return fee
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prevTxs, err = pool.PreviousTransactions(bumped)
+	if err != nil {
+		return nil, err
+	}
+	if unsigned := bumped.SignWithWalletDB(walletDB, prevTxs); unsigned > 0 {
+		return nil, fmt.Errorf("%d inputs of the replacement could not be signed", unsigned)
+	}
+
+	return bumped, nil
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestCheckReplacement(t *testing.T) {
+	tests := []struct {
+		name        string
+		descendants int
+		fee         Amount
+		size        int
+		spendsChild bool
+		replaced    int
+	}{
+		{"higher rate and fees", 0, 5500, 500, false, 1},
+		{"lower rate, enough fees", 0, 8000, 2000, false, 0},
+		{"fees short of the increment", 0, 5499, 500, false, 0},
+		{"fees of the descendant", 1, 7500, 500, false, 2},
+		{"fees short of the descendant", 1, 7499, 500, false, 0},
+		{"spends a replaced output", 1, 90000, 500, true, 0},
+		{"too many descendants", MaxReplacedEntries, 1000000, 500, false, 0},
+	}
+
+	for _, test := range tests {
+		pool := testMempool(DefaultPolicy.MaxMempoolSize)
+
+		// The original pays 5000 for 1000 bytes, and each descendant 2000
+		// for 500 bytes.
+		original := addTestEntry(pool, nil, 5000, 1000)
+		parent := original
+		for i := 0; i < test.descendants; i++ {
+			parent = addTestEntry(pool, parent, 2000, 500)
+		}
+
+		tx := &Transaction{
+			Inputs:  []TxInput{original.Tx.Inputs[0]},
+			Outputs: []TxOutput{*NewTxOutput(Coin, testAddress(7))},
+		}
+		if test.spendsChild {
+			tx.Inputs = append(tx.Inputs, TxInput{Id: parent.Tx.Id, Out: 0, Sequence: MaxSequence})
+		}
+		tx.SetID()
+		entry := &MempoolEntry{Tx: tx, Fee: test.fee, Size: test.size}
+
+		replaced, err := pool.checkReplacement(entry, []*MempoolEntry{original})
+		if test.replaced == 0 {
+			if err == nil {
+				t.Errorf("%s: replacement was accepted", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if len(replaced) != test.replaced {
+			t.Errorf("%s: replaced %d entries, want %d", test.name, len(replaced), test.replaced)
+		}
+	}
+}
+
+func TestConflictsSignalReplacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		sequence uint32
+		ok       bool
+	}{
+		{"final", MaxSequence, false},
+		{"lock time only", MaxSequence - 1, false},
+		{"replaceable", MaxReplaceableSequence, true},
+		{"relative lock", 10, true},
+	}
+
+	for _, test := range tests {
+		pool := testMempool(DefaultPolicy.MaxMempoolSize)
+		original := addTestEntry(pool, nil, 1000, 1000)
+		original.Tx.Inputs[0].Sequence = test.sequence
+
+		tx := &Transaction{Inputs: []TxInput{original.Tx.Inputs[0]}}
+		conflicts, err := pool.conflicts(tx)
+		if test.ok && (err != nil || len(conflicts) != 1 || conflicts[0] != original) {
+			t.Errorf("%s: conflicts %d entries, %v, want the original", test.name, len(conflicts), err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: transaction not signalling replacement was replaced", test.name)
+		}
+	}
+}
@@ -0,0 +1,498 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+const (
+	MaxScriptSize        = 10000
+	MaxScriptElement     = 520
+	MaxStackSize         = 1000
+	MaxOpsPerScript      = 201
+	MaxMultisigKeys      = 15
+	MaxDataCarrierSize   = 80
+	maxScriptNumLength   = 4
+	maxLockTimeNumLength = 5
+	publicKeyHashLength  = 20
+)
+
+const (
+	OP_0         = 0x00
+	OP_FALSE     = OP_0
+	OP_PUSHDATA1 = 0x4c
+	OP_PUSHDATA2 = 0x4d
+	OP_1NEGATE   = 0x4f
+	OP_1         = 0x51
+	OP_TRUE      = OP_1
+	OP_16        = 0x60
+
+	OP_NOP    = 0x61
+	OP_IF     = 0x63
+	OP_NOTIF  = 0x64
+	OP_ELSE   = 0x67
+	OP_ENDIF  = 0x68
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	OP_DROP = 0x75
+	OP_DUP  = 0x76
+	OP_OVER = 0x78
+	OP_SWAP = 0x7c
+	OP_SIZE = 0x82
+
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	OP_1ADD           = 0x8b
+	OP_1SUB           = 0x8c
+	OP_NOT            = 0x91
+	OP_ADD            = 0x93
+	OP_SUB            = 0x94
+	OP_NUMEQUAL       = 0x9c
+	OP_NUMEQUALVERIFY = 0x9d
+	OP_LESSTHAN       = 0x9f
+	OP_GREATERTHAN    = 0xa0
+	OP_WITHIN         = 0xa5
+	OP_SHA256         = 0xa8
+	OP_HASH160        = 0xa9
+	OP_CHECKSIG       = 0xac
+	OP_CHECKSIGVERIFY = 0xad
+
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	OP_CHECKSEQUENCEVERIFY = 0xb2
+)
+
+var opcodeNames = map[byte]string{
+	OP_0:              "OP_0",
+	OP_PUSHDATA1:      "OP_PUSHDATA1",
+	OP_PUSHDATA2:      "OP_PUSHDATA2",
+	OP_1NEGATE:        "OP_1NEGATE",
+	OP_NOP:            "OP_NOP",
+	OP_IF:             "OP_IF",
+	OP_NOTIF:          "OP_NOTIF",
+	OP_ELSE:           "OP_ELSE",
+	OP_ENDIF:          "OP_ENDIF",
+	OP_VERIFY:         "OP_VERIFY",
+	OP_RETURN:         "OP_RETURN",
+	OP_DROP:           "OP_DROP",
+	OP_DUP:            "OP_DUP",
+	OP_OVER:           "OP_OVER",
+	OP_SWAP:           "OP_SWAP",
+	OP_SIZE:           "OP_SIZE",
+	OP_EQUAL:          "OP_EQUAL",
+	OP_EQUALVERIFY:    "OP_EQUALVERIFY",
+	OP_1ADD:           "OP_1ADD",
+	OP_1SUB:           "OP_1SUB",
+	OP_NOT:            "OP_NOT",
+	OP_ADD:            "OP_ADD",
+	OP_SUB:            "OP_SUB",
+	OP_NUMEQUAL:       "OP_NUMEQUAL",
+	OP_NUMEQUALVERIFY: "OP_NUMEQUALVERIFY",
+	OP_LESSTHAN:       "OP_LESSTHAN",
+	OP_GREATERTHAN:    "OP_GREATERTHAN",
+	OP_WITHIN:         "OP_WITHIN",
+	OP_SHA256:         "OP_SHA256",
+	OP_HASH160:        "OP_HASH160",
+	OP_CHECKSIG:       "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY: "OP_CHECKSIGVERIFY",
+
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+}
+
+type Script []byte
+
+type ScriptOp struct {
+	Opcode byte
+	Data   []byte
+}
+
+type ScriptBuilder struct {
+	script Script
+}
+
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+func (b *ScriptBuilder) AddOp(opcode byte) *ScriptBuilder {
+	b.script = append(b.script, opcode)
+	return b
+}
+
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	length := len(data)
+
+	switch {
+	case length == 0:
+		b.script = append(b.script, OP_0)
+		return b
+	case length < OP_PUSHDATA1:
+		b.script = append(b.script, byte(length))
+	case length <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(length))
+	default:
+		b.script = append(b.script, OP_PUSHDATA2, byte(length), byte(length>>8))
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+func (b *ScriptBuilder) AddInt64(num int64) *ScriptBuilder {
+	switch {
+	case num == 0:
+		return b.AddOp(OP_0)
+	case num == -1:
+		return b.AddOp(OP_1NEGATE)
+	case num >= 1 && num <= 16:
+		return b.AddOp(byte(OP_1 - 1 + num))
+	}
+
+	return b.AddData(EncodeScriptNum(num))
+}
+
+func (b *ScriptBuilder) Script() Script {
+	return append(Script{}, b.script...)
+}
+
+func ParseScript(script Script) ([]ScriptOp, error) {
+	var ops []ScriptOp
+
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+
+		var length int
+		switch {
+		case opcode > OP_0 && opcode < OP_PUSHDATA1:
+			length = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, fmt.Errorf("script truncated in OP_PUSHDATA1 length")
+			}
+			length = int(script[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, fmt.Errorf("script truncated in OP_PUSHDATA2 length")
+			}
+			length = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			ops = append(ops, ScriptOp{opcode, nil})
+			continue
+		}
+
+		if i+length > len(script) {
+			return nil, fmt.Errorf("script truncated in %d byte push", length)
+		}
+		ops = append(ops, ScriptOp{opcode, script[i : i+length]})
+		i += length
+	}
+
+	return ops, nil
+}
+
+func (op ScriptOp) IsPush() bool {
+	return op.Opcode <= OP_16
+}
+
+func (op ScriptOp) String() string {
+	switch {
+	case op.Opcode > OP_0 && op.Opcode <= OP_PUSHDATA2:
+		return hex.EncodeToString(op.Data)
+	case op.Opcode >= OP_1 && op.Opcode <= OP_16:
+		return fmt.Sprintf("OP_%d", op.Opcode-OP_1+1)
+	}
+	if name, ok := opcodeNames[op.Opcode]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OP_UNKNOWN%d", op.Opcode)
+}
+
+func (s Script) IsPushOnly() bool {
+	ops, err := ParseScript(s)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !op.IsPush() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s Script) String() string {
+	ops, err := ParseScript(s)
+	if err != nil {
+		return fmt.Sprintf("[invalid script %x]", []byte(s))
+	}
+
+	var parts []string
+	for _, op := range ops {
+		parts = append(parts, op.String())
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func P2PKHScript(pubKeyHash []byte) Script {
+	return NewScriptBuilder().
+		AddOp(OP_DUP).
+		AddOp(OP_HASH160).
+		AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG).
+		Script()
+}
+
+func (s Script) IsP2PKH() bool {
+	return len(s) == 25 &&
+		s[0] == OP_DUP &&
+		s[1] == OP_HASH160 &&
+		s[2] == publicKeyHashLength &&
+		s[23] == OP_EQUALVERIFY &&
+		s[24] == OP_CHECKSIG
+}
+
+// Ed25519PKHScript is a P2PKH script that also requires a public key of
+// Ed25519 size, so the key type, and with it the address version, can be
+// told from the output.
+func Ed25519PKHScript(pubKeyHash []byte) Script {
+	return append(NewScriptBuilder().
+		AddOp(OP_SIZE).
+		AddInt64(ed25519.PublicKeySize).
+		AddOp(OP_EQUALVERIFY).
+		Script(), P2PKHScript(pubKeyHash)...)
+}
+
+func (s Script) IsEd25519PKH() bool {
+	return len(s) == 29 &&
+		s[0] == OP_SIZE &&
+		s[1] == 1 &&
+		s[2] == ed25519.PublicKeySize &&
+		s[3] == OP_EQUALVERIFY &&
+		s[4:].IsP2PKH()
+}
+
+// PubKeyHash returns the key hash of a P2PKH or Ed25519 P2PKH script.
+func (s Script) PubKeyHash() []byte {
+	switch {
+	case s.IsP2PKH():
+		return s[3:23]
+	case s.IsEd25519PKH():
+		return s[7:27]
+	}
+
+	return nil
+}
+
+func P2SHScript(scriptHash []byte) Script {
+	return NewScriptBuilder().
+		AddOp(OP_HASH160).
+		AddData(scriptHash).
+		AddOp(OP_EQUAL).
+		Script()
+}
+
+func (s Script) IsP2SH() bool {
+	return len(s) == 23 &&
+		s[0] == OP_HASH160 &&
+		s[1] == publicKeyHashLength &&
+		s[22] == OP_EQUAL
+}
+
+func (s Script) ScriptHash() []byte {
+	if !s.IsP2SH() {
+		return nil
+	}
+
+	return s[2:22]
+}
+
+func DataScript(data []byte) Script {
+	return NewScriptBuilder().AddOp(OP_RETURN).AddData(data).Script()
+}
+
+// IsUnspendable reports scripts that can never be satisfied, such as data
+// carriers. Outputs locked with them are never part of the unspent set.
+func (s Script) IsUnspendable() bool {
+	return (len(s) > 0 && s[0] == OP_RETURN) || len(s) > MaxScriptSize
+}
+
+func (s Script) IsDataCarrier() bool {
+	ops, err := ParseScript(s)
+	return err == nil && len(ops) == 2 && ops[0].Opcode == OP_RETURN && ops[1].IsPush()
+}
+
+func (s Script) DataPayload() []byte {
+	if !s.IsDataCarrier() {
+		return nil
+	}
+
+	ops, _ := ParseScript(s)
+	return ops[1].Data
+}
+
+// MultisigScript builds an m-of-n redeem script. Keys are sorted so that
+// every participant derives the same script, and hence the same address,
+// from the same key set.
+func MultisigScript(m int, pubKeys [][]byte) (Script, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxMultisigKeys {
+		return nil, fmt.Errorf("multisig needs between 1 and %d keys", MaxMultisigKeys)
+	}
+	if m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("multisig threshold %d is not within 1 and %d", m, len(pubKeys))
+	}
+
+	builder := NewScriptBuilder().AddInt64(int64(m))
+	for _, pubKey := range wallet.SortPublicKeys(pubKeys) {
+		builder.AddData(pubKey)
+	}
+	script := builder.AddInt64(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script()
+
+	if len(script) > MaxScriptElement {
+		return nil, fmt.Errorf("multisig script of %d bytes exceeds %d", len(script), MaxScriptElement)
+	}
+
+	return script, nil
+}
+
+func ParseMultisigScript(script Script) (int, [][]byte, error) {
+	ops, err := ParseScript(script)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(ops) < 4 || ops[len(ops)-1].Opcode != OP_CHECKMULTISIG {
+		return 0, nil, fmt.Errorf("script is not a multisig script")
+	}
+
+	m, okM := smallInt(ops[0])
+	n, okN := smallInt(ops[len(ops)-2])
+	if !okM || !okN || n != len(ops)-3 || m < 1 || m > n {
+		return 0, nil, fmt.Errorf("script is not a multisig script")
+	}
+
+	var pubKeys [][]byte
+	for _, op := range ops[1 : len(ops)-2] {
+		pubKeys = append(pubKeys, op.Data)
+	}
+
+	return m, pubKeys, nil
+}
+
+func smallInt(op ScriptOp) (int, bool) {
+	if op.Opcode >= OP_1 && op.Opcode <= OP_16 {
+		return int(op.Opcode - OP_1 + 1), true
+	}
+	return 0, false
+}
+
+func AddressScript(address string) Script {
+	hash := wallet.AddressHash(address)
+
+	if wallet.IsMultisigAddress(address) {
+		return P2SHScript(hash)
+	}
+	if wallet.IsEd25519Address(address) {
+		return Ed25519PKHScript(hash)
+	}
+
+	return P2PKHScript(hash)
+}
+
+// Address renders the address a standard script pays to.
+func (s Script) Address() string {
+	switch {
+	case s.IsP2PKH():
+		return string(wallet.AddressFromPubKeyHash(s.PubKeyHash()))
+	case s.IsEd25519PKH():
+		return string(wallet.Ed25519Address(s.PubKeyHash()))
+	case s.IsP2SH():
+		return string(wallet.AddressFromScriptHash(s.ScriptHash()))
+	}
+
+	return ""
+}
+
+func EncodeScriptNum(num int64) []byte {
+	if num == 0 {
+		return nil
+	}
+
+	negative := num < 0
+	abs := num
+	if negative {
+		abs = -num
+	}
+
+	var result []byte
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+func DecodeScriptNum(data []byte, maxLength int) (int64, error) {
+	if len(data) > maxLength {
+		return 0, fmt.Errorf("script number of %d bytes exceeds %d", len(data), maxLength)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if data[len(data)-1]&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, fmt.Errorf("script number %x is not minimally encoded", data)
+	}
+
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << uint(8*i)
+	}
+
+	if data[len(data)-1]&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
+
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			if i == len(data)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxBlockSize limits the serialized size of the transactions of a block.
+const MaxBlockSize = 1000000
+
+// BlockTemplate is a block waiting for its proof of work: a coinbase that
+// pays the subsidy and fees to the miner, followed by pool transactions.
+// Every header field but the nonce and hash is set.
+type BlockTemplate struct {
+	Block *Block
+	Fees  Amount
+	Size  int
+}
+
+// NewBlockTemplate fills a block with the pool transactions that pay the
+// highest fee rate. Each entry is ranked together with its unconfirmed
+// ancestors, which have to be mined first, so the rate of a package is its
+// total fee over its total size.
+func (pool *Mempool) NewBlockTemplate(address string) (*BlockTemplate, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.newBlockTemplate(address)
+}
+
+func (pool *Mempool) newBlockTemplate(address string) (*BlockTemplate, error) {
+	lastBlock, err := pool.chain.GetBlock(pool.chain.LastHash)
+	if err != nil {
+		return nil, err
+	}
+	height := lastBlock.Height + 1
+
+	timestamp := time.Now().Unix()
+	if medianTime := pool.chain.MedianTimePast(pool.chain.LastHash); timestamp < medianTime {
+		timestamp = medianTime
+	}
+
+	data := fmt.Sprintf("Shells to %s at height %d", address, height)
+	coinbase := newCoinbaseTx(address, data, Subsidy)
+
+	var fees Amount
+	txs := []*Transaction{nil}
+	size := coinbase.Size()
+
+	for _, entry := range pool.selectEntries(MaxBlockSize - size) {
+		if fees, err = fees.Add(entry.Fee); err != nil {
+			return nil, err
+		}
+		txs = append(txs, entry.Tx)
+		size += entry.Size
+	}
+
+	reward, err := Subsidy.Add(fees)
+	if err != nil {
+		return nil, err
+	}
+	txs[0] = newCoinbaseTx(address, data, reward)
+
+	block := &Block{
+		Timestamp:    uint(timestamp),
+		PrevHash:     pool.chain.LastHash,
+		Transactions: txs,
+		Height:       height,
+	}
+
+	return &BlockTemplate{block, fees, size}, nil
+}
+
+// selectEntries picks packages by fee rate until no other fits in limit
+// bytes. The result lists parents before their children.
+func (pool *Mempool) selectEntries(limit int) []*MempoolEntry {
+	order := make(map[*MempoolEntry]int)
+	scores := make(map[*MempoolEntry]packageScore)
+	candidates := &packageHeap{order: order}
+
+	for i, entry := range pool.sortedEntries() {
+		order[entry] = i
+
+		score := packageScore{entry, entry.Fee, entry.Size}
+		for _, ancestor := range pool.ancestors(entry) {
+			score.fees = saturatingAdd(score.fees, ancestor.Fee)
+			score.size += ancestor.Size
+		}
+		scores[entry] = score
+		candidates.scores = append(candidates.scores, score)
+	}
+	heap.Init(candidates)
+
+	included := make(map[*MempoolEntry]bool)
+	var selected []*MempoolEntry
+	size := 0
+
+	for candidates.Len() > 0 {
+		best := heap.Pop(candidates).(packageScore)
+		// Scores pushed before the package changed are stale.
+		if score, ok := scores[best.entry]; !ok || score != best {
+			continue
+		}
+		delete(scores, best.entry)
+
+		if size+best.size > limit {
+			continue
+		}
+
+		pkg := pool.ancestorPackage(best.entry, included, order)
+		for _, entry := range pkg {
+			included[entry] = true
+			delete(scores, entry)
+		}
+
+		// Only the packages of descendants of what was just included
+		// change: they no longer count those ancestors.
+		changed := make(map[*MempoolEntry]bool)
+		for _, entry := range pkg {
+			for _, descendant := range pool.descendants(entry) {
+				score, ok := scores[descendant]
+				if !ok {
+					continue
+				}
+				if score.fees -= entry.Fee; score.fees < 0 {
+					score.fees = 0
+				}
+				score.size -= entry.Size
+				scores[descendant] = score
+				changed[descendant] = true
+			}
+		}
+		for entry := range changed {
+			heap.Push(candidates, scores[entry])
+		}
+
+		selected = append(selected, pkg...)
+		size += best.size
+	}
+
+	return selected
+}
+
+// packageScore sums up the fee and size of an entry and its ancestors
+// that are not in the block yet.
+type packageScore struct {
+	entry *MempoolEntry
+	fees  Amount
+	size  int
+}
+
+// packageHeap orders package scores by fee rate, and equal rates by the
+// position of their entry in the pool.
+type packageHeap struct {
+	scores []packageScore
+	order  map[*MempoolEntry]int
+}
+
+func (h *packageHeap) Len() int { return len(h.scores) }
+
+func (h *packageHeap) Less(i, j int) bool {
+	a, b := h.scores[i], h.scores[j]
+	if rateA, rateB := NewFeeRate(a.fees, a.size), NewFeeRate(b.fees, b.size); rateA != rateB {
+		return rateA > rateB
+	}
+	return h.order[a.entry] < h.order[b.entry]
+}
+
+func (h *packageHeap) Swap(i, j int) { h.scores[i], h.scores[j] = h.scores[j], h.scores[i] }
+
+func (h *packageHeap) Push(x interface{}) { h.scores = append(h.scores, x.(packageScore)) }
+
+func (h *packageHeap) Pop() interface{} {
+	last := h.scores[len(h.scores)-1]
+	h.scores = h.scores[:len(h.scores)-1]
+
+	return last
+}
+
+// ancestorPackage returns entry and its ancestors that are not included
+// yet, in the order they can be mined.
+func (pool *Mempool) ancestorPackage(entry *MempoolEntry, included map[*MempoolEntry]bool, order map[*MempoolEntry]int) []*MempoolEntry {
+	pkg := []*MempoolEntry{entry}
+
+	for _, ancestor := range pool.ancestors(entry) {
+		if !included[ancestor] {
+			pkg = append(pkg, ancestor)
+		}
+	}
+	sort.Slice(pkg, func(i, j int) bool { return order[pkg[i]] < order[pkg[j]] })
+
+	return pkg
+}
+
+func packageFeeRate(entries []*MempoolEntry) FeeRate {
+	var fees Amount
+	size := 0
+
+	for _, entry := range entries {
+		fees = saturatingAdd(fees, entry.Fee)
+		size += entry.Size
+	}
+
+	return NewFeeRate(fees, size)
+}
+
+// Mine builds a template paying the block reward to address, runs the
+// proof of work and adds the block to the chain.
+func (pool *Mempool) Mine(address string) (*BlockTemplate, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	template, err := pool.newBlockTemplate(address)
+	if err != nil {
+		return nil, err
+	}
+
+	template.Block.Mine()
+	if err := pool.chain.connectBlock(template.Block); err != nil {
+		return nil, err
+	}
+
+	return template, pool.sync()
+}
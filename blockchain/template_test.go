@@ -0,0 +1,40 @@
+package blockchain
+
+import "testing"
+
+func TestSelectEntriesRanksPackages(t *testing.T) {
+	pool := testMempool(DefaultPolicy.MaxMempoolSize)
+
+	parent := addTestEntry(pool, nil, 500, 1000)
+	child := addTestEntry(pool, parent, 9500, 1000)
+	single := addTestEntry(pool, nil, 4000, 1000)
+	grandchild := addTestEntry(pool, child, 3000, 1000)
+	low := addTestEntry(pool, nil, 1000, 1000)
+
+	tests := []struct {
+		limit int
+		want  []*MempoolEntry
+	}{
+		// The child pays for its parent, 5000 per 1000 bytes together,
+		// before the single entry. Once they are in, the grandchild pays
+		// 3000 on its own.
+		{5000, []*MempoolEntry{parent, child, single, grandchild, low}},
+		// A package that does not fit is skipped for smaller ones.
+		{1500, []*MempoolEntry{single}},
+		{2500, []*MempoolEntry{parent, child}},
+		{0, nil},
+	}
+
+	for _, test := range tests {
+		selected := pool.selectEntries(test.limit)
+		if len(selected) != len(test.want) {
+			t.Errorf("limit %d: selected %d entries, want %d", test.limit, len(selected), len(test.want))
+			continue
+		}
+		for i, entry := range selected {
+			if entry != test.want[i] {
+				t.Errorf("limit %d: entry %d paying %s, want the one paying %s", test.limit, i, entry.Fee, test.want[i].Fee)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+const (
+	LockTimeThreshold   = 500000000
+	MaxSequence         = 0xffffffff
+	SequenceDisableFlag = 1 << 31
+	SequenceTypeFlag    = 1 << 22
+	SequenceMask        = 0x0000ffff
+	SequenceGranularity = 9
+	medianTimeBlocks    = 11
+)
+
+// MedianTimePast is the median timestamp of the block with the given hash
+// and up to ten of its ancestors. Time based locks are measured against it
+// so that a single miner cannot push them forward with its own clock.
+func (chain *BlockChain) MedianTimePast(hash []byte) int64 {
+	var timestamps []int64
+
+	for len(hash) != 0 && len(timestamps) < medianTimeBlocks {
+		block, err := chain.GetBlock(hash)
+		HandleFatalErrors(err)
+
+		timestamps = append(timestamps, int64(block.Timestamp))
+		hash = block.PrevHash
+	}
+
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
+
+func (tx *Transaction) IsFinal(height int, medianTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	limit := int64(height)
+	if tx.LockTime >= LockTimeThreshold {
+		limit = medianTime
+	}
+	if int64(tx.LockTime) < limit {
+		return true
+	}
+
+	for _, in := range tx.Inputs {
+		if in.Sequence != MaxSequence {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckTransactionLocks enforces the transaction lock time and the relative
+// lock of every input for a block at height whose parent has medianTime.
+func (chain *BlockChain) CheckTransactionLocks(tx *Transaction, height int, medianTime int64) error {
+	return chain.checkTransactionLocks(tx, height, medianTime, nil)
+}
+
+// checkTransactionLocks treats inputs spending pending transactions as if
+// those were confirmed in the same block as tx.
+func (chain *BlockChain) checkTransactionLocks(tx *Transaction, height int, medianTime int64, pending map[string]*Transaction) error {
+	if !tx.IsFinal(height, medianTime) {
+		if tx.LockTime < LockTimeThreshold {
+			return fmt.Errorf("transaction %x is locked until height %d has passed", tx.Id, tx.LockTime)
+		}
+		return fmt.Errorf("transaction %x is locked until time %d has passed", tx.Id, tx.LockTime)
+	}
+
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for inId, in := range tx.Inputs {
+		if in.Sequence&SequenceDisableFlag != 0 {
+			continue
+		}
+
+		prevHeight, prevTime := height, medianTime
+		if _, ok := pending[hex.EncodeToString(in.Id)]; !ok {
+			_, block, err := chain.FindTransactionBlock(in.Id)
+			if err != nil {
+				return err
+			}
+			prevHeight, prevTime = block.Height, chain.MedianTimePast(block.PrevHash)
+		}
+
+		if in.Sequence&SequenceTypeFlag != 0 {
+			lockSeconds := int64(in.Sequence&SequenceMask) << SequenceGranularity
+			if prevTime+lockSeconds > medianTime {
+				return fmt.Errorf("input %d of %x is locked until time %d", inId, tx.Id, prevTime+lockSeconds)
+			}
+		} else {
+			lockHeight := prevHeight + int(in.Sequence&SequenceMask)
+			if lockHeight > height {
+				return fmt.Errorf("input %d of %x is locked until height %d", inId, tx.Id, lockHeight)
+			}
+		}
+	}
+
+	return nil
+}
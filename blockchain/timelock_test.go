@@ -0,0 +1,117 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIsFinal(t *testing.T) {
+	const now = LockTimeThreshold + 1000
+
+	tests := []struct {
+		name     string
+		lockTime uint32
+		sequence uint32
+		final    bool
+	}{
+		{"no lock time", 0, 0, true},
+		{"height passed", 99, 0, true},
+		{"height of the block", 100, 0, false},
+		{"height ahead", 150, 0, false},
+		{"height ahead, final inputs", 150, MaxSequence, true},
+		{"time passed", now - 1, 0, true},
+		{"time reached", now, 0, false},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{
+			Inputs:   []TxInput{{Id: bytes.Repeat([]byte{1}, 32), Sequence: test.sequence}},
+			LockTime: test.lockTime,
+		}
+		if final := tx.IsFinal(100, now); final != test.final {
+			t.Errorf("%s: final = %t, want %t", test.name, final, test.final)
+		}
+	}
+}
+
+func TestLockTimeOpcodes(t *testing.T) {
+	lock := func(opcode byte, n int64) Script {
+		return NewScriptBuilder().AddInt64(n).AddOp(opcode).AddOp(OP_DROP).AddOp(OP_1).Script()
+	}
+
+	tests := []struct {
+		name     string
+		lock     Script
+		lockTime uint32
+		sequence uint32
+		ok       bool
+	}{
+		{"CLTV height reached", lock(OP_CHECKLOCKTIMEVERIFY, 100), 100, 0, true},
+		{"CLTV height ahead", lock(OP_CHECKLOCKTIMEVERIFY, 101), 100, 0, false},
+		{"CLTV final input", lock(OP_CHECKLOCKTIMEVERIFY, 100), 100, MaxSequence, false},
+		{"CLTV time against height", lock(OP_CHECKLOCKTIMEVERIFY, LockTimeThreshold), 100, 0, false},
+		{"CLTV time reached", lock(OP_CHECKLOCKTIMEVERIFY, LockTimeThreshold+10), LockTimeThreshold + 10, 0, true},
+		{"CLTV negative", lock(OP_CHECKLOCKTIMEVERIFY, -1), 100, 0, false},
+
+		{"CSV blocks reached", lock(OP_CHECKSEQUENCEVERIFY, 10), 0, 10, true},
+		{"CSV blocks ahead", lock(OP_CHECKSEQUENCEVERIFY, 11), 0, 10, false},
+		{"CSV disabled input", lock(OP_CHECKSEQUENCEVERIFY, 10), 0, SequenceDisableFlag | 10, false},
+		{"CSV time against blocks", lock(OP_CHECKSEQUENCEVERIFY, SequenceTypeFlag|10), 0, 10, false},
+		{"CSV time reached", lock(OP_CHECKSEQUENCEVERIFY, SequenceTypeFlag|10), 0, SequenceTypeFlag | 20, true},
+		{"CSV disabled lock", lock(OP_CHECKSEQUENCEVERIFY, SequenceDisableFlag), 0, MaxSequence, true},
+	}
+
+	for _, test := range tests {
+		prevOut := TxOutput{Value: Coin, Script: test.lock}
+		tx := &Transaction{
+			Inputs:   []TxInput{{Id: bytes.Repeat([]byte{1}, 32), Sequence: test.sequence}},
+			Outputs:  []TxOutput{*NewTxOutput(Coin/2, testAddress(1))},
+			LockTime: test.lockTime,
+		}
+		tx.SetID()
+
+		err := tx.VerifyInput(0, prevOut)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: input was unlocked", test.name)
+		}
+	}
+}
+
+func TestCheckTransactionLocksRelative(t *testing.T) {
+	chain := testChain(t, testAddress(1))
+	genesis, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		sequence   uint32
+		height     int
+		medianTime int64
+		ok         bool
+	}{
+		{"disabled", MaxSequence, 1, 0, true},
+		{"blocks ahead", 2, 1, 0, false},
+		{"blocks reached", 2, 2, 0, true},
+		{"time ahead", SequenceTypeFlag | 1, 1, 1<<SequenceGranularity - 1, false},
+		{"time reached", SequenceTypeFlag | 1, 1, 1 << SequenceGranularity, true},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{
+			Inputs:  []TxInput{{Id: genesis.Transactions[0].Id, Out: 0, Sequence: test.sequence}},
+			Outputs: []TxOutput{*NewTxOutput(Coin, testAddress(2))},
+		}
+		tx.SetID()
+
+		err := chain.CheckTransactionLocks(tx, test.height, test.medianTime)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s: locked input was spent", test.name)
+		}
+	}
+}
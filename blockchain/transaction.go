@@ -1,143 +1,392 @@
 package blockchain
 
 import (
-	"bytes"
-	"encoding/gob"
 	"encoding/hex"
 	"fmt"
-	"log"
-	"math/big"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 
 	"github.com/goozt/seashell/wallet"
 )
 
 type Transaction struct {
-	Id      []byte
-	Inputs  []TxInput
-	Outputs []TxOutput
+	Id       []byte
+	Inputs   []TxInput
+	Outputs  []TxOutput
+	LockTime uint32
 }
 
-func NewTransaction(from, to string, amount int, chain *BlockChain) *Transaction {
-	var inputs []TxInput
-	var outputs []TxOutput
+type Payment struct {
+	Address string
+	Amount  Amount
+}
+
+type SendOptions struct {
+	Selector CoinSelector
+	LockTime uint32
+	Memo     []byte
+	FeeRate  FeeRate
+	// Replaceable lets the transaction be replaced in the memory pool by
+	// one paying a higher fee until it is mined.
+	Replaceable bool
+}
+
+// estimatedWitnessSize is the encoded size of a pay-to-pubkey-hash witness
+// with the longest DER signature and an uncompressed P-256 key.
+const estimatedWitnessSize = 4 + 4 + 72 + 4 + 65
+
+// UTXOView is what new transactions are funded and signed from: the chain
+// alone, or a Mempool that adds its unconfirmed transactions to it.
+type UTXOView interface {
+	FindUnspentOutputs(publicKeyHash []byte) []UnspentOutput
+	PreviousTransactions(tx *Transaction) (map[string]Transaction, error)
+}
+
+func NewTransaction(from, to string, amount Amount, view UTXOView, options SendOptions) *Transaction {
+	return NewPaymentTransaction([]string{from}, []Payment{{to, amount}}, view, options)
+}
+
+func NewPaymentTransaction(from []string, payments []Payment, view UTXOView, options SendOptions) *Transaction {
+	return NewWalletTransaction(from, PaymentOutputs(payments), view, options)
+}
+
+// NewWalletTransaction funds outputs from the wallet keys of the from
+// addresses and signs the result. Change goes back to the first address.
+func NewWalletTransaction(from []string, outputs []TxOutput, view UTXOView, options SendOptions) *Transaction {
+	var utxos []UnspentOutput
 
 	walletDB, err := wallet.CreateWalletDB()
 	HandleFatalErrors(err)
 
-	w := walletDB.GetWallet(from)
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	owners := make(map[string]wallet.Wallet)
+
+	for _, address := range from {
+		w, ok := walletDB.Wallets[address]
+		if !ok {
+			HandleFatalErrors(fmt.Errorf("error: no wallet for address %s", address))
+		}
 
-	acc, validOutput := chain.FindSpendableOutputs(pubKeyHash, amount)
+		pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+		if _, seen := owners[hex.EncodeToString(pubKeyHash)]; seen {
+			continue
+		}
 
-	if acc < amount {
-		HandleFatalErrors(fmt.Errorf("error: not enough funds"))
+		owners[hex.EncodeToString(pubKeyHash)] = *w
+		utxos = append(utxos, view.FindUnspentOutputs(pubKeyHash)...)
 	}
 
-	for txid, outs := range validOutput {
-		txId, err := hex.DecodeString(txid)
+	tx, err := FundTransaction(utxos, outputs, from[0], options)
+	HandleFatalErrors(err)
+
+	prevTxs, err := view.PreviousTransactions(tx)
+	HandleFatalErrors(err)
+
+	for _, w := range owners {
+		err = tx.Sign(w, prevTxs)
 		HandleFatalErrors(err)
+	}
+
+	return tx
+}
+
+func PaymentOutputs(payments []Payment) []TxOutput {
+	var outputs []TxOutput
+
+	for _, payment := range payments {
+		outputs = append(outputs, *NewTxOutput(payment.Amount, payment.Address))
+	}
+
+	return outputs
+}
 
-		for _, out := range outs {
-			input := TxInput{txId, out, nil, w.PublicKey}
-			inputs = append(inputs, input)
+// FundTransaction builds an unsigned transaction paying outputs from a
+// selection of utxos, returning anything left over to changeAddress. The
+// fee follows options.FeeRate and the size the transaction will have once
+// signed, so coins are selected again until they cover it. Change that
+// would be dust is left to the fee.
+func FundTransaction(utxos []UnspentOutput, outputs []TxOutput, changeAddress string, options SendOptions) (*Transaction, error) {
+	return fundTransaction(nil, utxos, outputs, changeAddress, options, estimatedWitnessSize, options.FeeRate.Fee)
+}
+
+// fundTransaction spends every one of required and as many of utxos as it
+// takes to pay outputs and the fee that fee returns for the signed size,
+// with a witness of witnessSize bytes on each input.
+func fundTransaction(required, utxos []UnspentOutput, outputs []TxOutput, changeAddress string, options SendOptions, witnessSize int, fee func(size int) Amount) (*Transaction, error) {
+	var amount, requiredValue Amount
+	for _, out := range outputs {
+		var err error
+		if amount, err = amount.Add(out.Value); err != nil {
+			return nil, err
 		}
 	}
 
-	outputs = append(outputs, *NewTxOutput(amount, to))
+	selector := options.Selector
+	if selector == nil {
+		selector = DefaultCoinSelector
+	}
 
-	if acc > amount {
-		outputs = append(outputs, *NewTxOutput(acc-amount, from))
+	for _, utxo := range required {
+		requiredValue = saturatingAdd(requiredValue, utxo.Output.Value)
 	}
 
-	tx := Transaction{nil, inputs, outputs}
-	tx.Id = tx.Hash()
-	chain.SignTransaction(&tx, w.PrivateKey)
+	var paid Amount
+	for {
+		target, err := amount.Add(paid)
+		if err != nil {
+			return nil, err
+		}
 
-	return &tx
+		selected := required
+		if requiredValue < target {
+			selected = append(append([]UnspentOutput{}, required...), selector.Select(utxos, target-requiredValue)...)
+		}
+
+		var inputs []TxInput
+		var acc Amount
+		for _, utxo := range selected {
+			inputs = append(inputs, TxInput{utxo.TxId, utxo.Index, nil, MaxSequence, nil})
+			acc = saturatingAdd(acc, utxo.Output.Value)
+		}
+
+		if acc < target {
+			return nil, fmt.Errorf("error: not enough funds")
+		}
+
+		funded := append([]TxOutput{}, outputs...)
+		if change := NewTxOutput(acc-target, changeAddress); acc > target && !DefaultPolicy.IsDust(*change) {
+			funded = append(funded, *change)
+		}
+
+		tx, err := NewRawTransaction(inputs, funded, options)
+		if err != nil {
+			return nil, err
+		}
+
+		needed := fee(tx.Size() + len(inputs)*witnessSize)
+		if needed <= paid {
+			return tx, nil
+		}
+		paid = needed
+	}
+}
+
+// NewRawTransaction builds an unsigned transaction spending exactly the
+// given inputs. Sequences are set so that options.LockTime is enforced and
+// replaceability signalled as options asks, and a memo, if any, is added as
+// a data output.
+func NewRawTransaction(inputs []TxInput, outputs []TxOutput, options SendOptions) (*Transaction, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("transaction has no inputs")
+	}
+
+	sequence := uint32(MaxSequence)
+	if options.Replaceable {
+		sequence = MaxReplaceableSequence
+	} else if options.LockTime != 0 {
+		sequence = MaxSequence - 1
+	}
+
+	var unsigned []TxInput
+	for _, in := range inputs {
+		unsigned = append(unsigned, TxInput{in.Id, in.Out, nil, sequence, nil})
+	}
+
+	outputs = append([]TxOutput{}, outputs...)
+	if len(options.Memo) > 0 {
+		outputs = append(outputs, TxOutput{0, DataScript(options.Memo)})
+	}
+
+	tx := Transaction{nil, unsigned, outputs, options.LockTime}
+	if err := tx.CheckOutputs(); err != nil {
+		return nil, err
+	}
+	tx.SetID()
+
+	return &tx, nil
 }
 
+// Subsidy is the value of the coinbase output.
+const Subsidy = 100 * Coin
+
 func CoinbaseTx(to, data string) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Shells to %s", to)
 	}
 
-	txin := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTxOutput(100, to)
+	return newCoinbaseTx(to, data, Subsidy)
+}
 
-	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}}
+func newCoinbaseTx(to, data string, value Amount) *Transaction {
+	txin := TxInput{[]byte{}, -1, NewScriptBuilder().AddData([]byte(data)).Script(), MaxSequence, nil}
+	txout := NewTxOutput(value, to)
+
+	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}, 0}
 	tx.SetID()
 
 	return &tx
 }
 
 func (tx Transaction) Serialize() []byte {
-	var encoder bytes.Buffer
+	var e encoder
+	e.putTransaction(&tx, true)
 
-	enc := gob.NewEncoder(&encoder)
-	err := enc.Encode(tx)
-	HandleFatalErrors(err)
+	return e.Bytes()
+}
 
-	return encoder.Bytes()
+// DeserializeTransaction decodes a transaction and derives its id.
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	d := newDecoder(data)
+	tx := d.transaction()
+	if err := d.Finish("transaction"); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	tx.SetID()
+
+	return tx, nil
 }
 
+// Hash is the transaction id, which leaves out the witnesses.
 func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+	var e encoder
+	e.putTransaction(tx, false)
+
+	hash := sha256.Sum256(e.Bytes())
 
-	txCopy := *tx
-	txCopy.Id = []byte{}
+	return hash[:]
+}
 
-	hash = sha256.Sum256(txCopy.Serialize())
+// WitnessHash covers the witnesses as well. It equals the id for
+// transactions without witnesses.
+func (tx *Transaction) WitnessHash() []byte {
+	hash := sha256.Sum256(tx.Serialize())
 
 	return hash[:]
 }
 
-func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-	var hash [32]byte
+// Size is the length of the serialized transaction, witnesses included.
+func (tx *Transaction) Size() int {
+	return len(tx.Serialize())
+}
 
-	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(tx)
-	HandleFatalErrors(err)
+func (tx *Transaction) HasWitness() bool {
+	for _, in := range tx.Inputs {
+		if len(in.Witness) > 0 {
+			return true
+		}
+	}
 
-	hash = sha256.Sum256(encoded.Bytes())
-	tx.Id = hash[:]
+	return false
+}
+
+func (tx *Transaction) SetID() {
+	tx.Id = tx.Hash()
 }
 
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].Id) == 0 && tx.Inputs[0].Out == -1
 }
 
-func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTxs map[string]Transaction) {
+func (tx *Transaction) CheckOutputs() error {
+	var total Amount
+
+	for outId, out := range tx.Outputs {
+		var err error
+		if total, err = total.Add(out.Value); err != nil {
+			return fmt.Errorf("output %d: %v", outId, err)
+		}
+		if !out.Script.IsUnspendable() {
+			continue
+		}
+		if out.Value != 0 {
+			return fmt.Errorf("unspendable output %d carries value %s", outId, out.Value)
+		}
+		if payload := out.Script.DataPayload(); len(payload) > MaxDataCarrierSize {
+			return fmt.Errorf("data output %d of %d bytes exceeds %d", outId, len(payload), MaxDataCarrierSize)
+		}
+	}
+
+	return nil
+}
+
+// SignatureHash is the hash signed for input inId, which spends prevOut.
+// It commits to the value of prevOut as well as its locking script, so a
+// signer told the wrong value, and hence the wrong fee, signs nothing the
+// chain accepts.
+func (tx *Transaction) SignatureHash(inId int, prevOut TxOutput) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[inId].Script = prevOut.Script
+
+	var e encoder
+	e.PutBytes(txCopy.Hash())
+	e.PutUint64(uint64(prevOut.Value))
+	hash := sha256.Sum256(e.Bytes())
+
+	return hash[:]
+}
+
+func (tx *Transaction) Sign(w wallet.Wallet, prevTxs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return
+		return nil
 	}
-	for _, in := range tx.Inputs {
-		if prevTxs[hex.EncodeToString(in.Id)].Id == nil {
-			log.Fatalln("Error: Previous transaction is not correct")
+	for inId, in := range tx.Inputs {
+		prevTx, ok := prevTxs[hex.EncodeToString(in.Id)]
+		if !ok {
+			return fmt.Errorf("input %d spends unknown transaction %x", inId, in.Id)
+		}
+		if in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+			return fmt.Errorf("input %d spends missing output %x:%d", inId, in.Id, in.Out)
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
 
-	for inId, in := range txCopy.Inputs {
-		prevTx := prevTxs[hex.EncodeToString(in.Id)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.Id = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+	for inId, in := range tx.Inputs {
+		prevOut := prevTxs[hex.EncodeToString(in.Id)].Outputs[in.Out]
+		if !prevOut.IsLockedWithKey(pubKeyHash) {
+			continue
+		}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, txCopy.Id)
-		HandleFatalErrors(err)
-		signature := append(r.Bytes(), s.Bytes()...)
-		tx.Inputs[inId].Signature = signature
+		signature := w.Sign(tx.SignatureHash(inId, prevOut))
+		tx.Inputs[inId].Witness = [][]byte{signature, w.PublicKey}
 	}
 
+	return nil
+}
+
+// SignWithWalletDB signs every pay-to-pubkey-hash input whose key is in
+// walletDB and returns the number of inputs that are still unsigned.
+func (tx *Transaction) SignWithWalletDB(walletDB *wallet.WalletDB, prevTxs map[string]Transaction) int {
+	signed := make(map[string]bool)
+
+	for _, in := range tx.Inputs {
+		prevTx, ok := prevTxs[hex.EncodeToString(in.Id)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+			continue
+		}
+
+		pubKeyHash := prevTx.Outputs[in.Out].Script.PubKeyHash()
+		w, ok := walletDB.FindWallet(pubKeyHash)
+		if !ok || signed[hex.EncodeToString(pubKeyHash)] {
+			continue
+		}
+
+		if tx.Sign(*w, prevTxs) != nil {
+			break
+		}
+		signed[hex.EncodeToString(pubKeyHash)] = true
+	}
+
+	unsigned := 0
+	for _, in := range tx.Inputs {
+		if len(in.Script) == 0 && len(in.Witness) == 0 {
+			unsigned++
+		}
+	}
+
+	return unsigned
 }
 
 func (tx *Transaction) TrimmedCopy() *Transaction {
@@ -145,75 +394,134 @@ func (tx *Transaction) TrimmedCopy() *Transaction {
 	var outputs []TxOutput
 
 	for _, in := range tx.Inputs {
-		inputs = append(inputs, TxInput{in.Id, in.Out, nil, nil})
+		inputs = append(inputs, TxInput{in.Id, in.Out, nil, in.Sequence, nil})
 	}
 
 	for _, out := range tx.Outputs {
-		outputs = append(outputs, TxOutput{out.Value, out.PubKeyHash})
+		outputs = append(outputs, TxOutput{out.Value, out.Script})
 	}
 
-	txCopy := Transaction{tx.Id, inputs, outputs}
+	txCopy := Transaction{tx.Id, inputs, outputs, tx.LockTime}
 
 	return &txCopy
 }
 
-func SplitBinary(data []byte) (a big.Int, b big.Int) {
-	length := len(data)
-	a.SetBytes(data[:(length / 2)])
-	b.SetBytes(data[(length / 2):])
-	return a, b
+type txSignatureChecker struct {
+	tx      *Transaction
+	inId    int
+	prevOut TxOutput
 }
 
-func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool {
-	if tx.IsCoinbase() {
-		return true
+func (c txSignatureChecker) CheckLockTime(lockTime int64) bool {
+	if c.tx.Inputs[c.inId].Sequence == MaxSequence {
+		return false
 	}
 
-	for _, in := range tx.Inputs {
-		if prevTxs[hex.EncodeToString(in.Id)].Id == nil {
-			log.Fatalln("previous transaction does not exists")
-		}
+	txLockTime := int64(c.tx.LockTime)
+	if (txLockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+		return false
 	}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	return lockTime <= txLockTime
+}
 
-	for inId, in := range tx.Inputs {
-		prevTx := prevTxs[hex.EncodeToString(in.Id)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.Id = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+func (c txSignatureChecker) CheckSequence(sequence int64) bool {
+	txSequence := int64(c.tx.Inputs[c.inId].Sequence)
+	if txSequence&SequenceDisableFlag != 0 {
+		return false
+	}
+	if (txSequence&SequenceTypeFlag == 0) != (sequence&SequenceTypeFlag == 0) {
+		return false
+	}
 
-		r, s := SplitBinary(in.Signature)
-		x, y := SplitBinary(in.PubKey)
+	return sequence&SequenceMask <= txSequence&SequenceMask
+}
 
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if !ecdsa.Verify(&rawPubKey, txCopy.Id, &r, &s) {
-			return false
-		}
+func (c txSignatureChecker) CheckSignature(signature, pubKey []byte) bool {
+	hash := c.tx.SignatureHash(c.inId, c.prevOut)
+
+	return wallet.VerifySignature(pubKey, hash, signature)
+}
+
+func (tx *Transaction) VerifyInput(inId int, prevOut TxOutput) error {
+	checker := txSignatureChecker{tx, inId, prevOut}
+
+	in := tx.Inputs[inId]
+
+	// The id covers Script, so anything unlocking in it could be re-encoded
+	// by relaying nodes.
+	if len(in.Script) > 0 {
+		return fmt.Errorf("input has an unlocking script, only coinbase inputs may")
 	}
 
-	return true
+	return ExecuteWitness(in.Witness, prevOut.Script, checker)
+}
+
+// Verify reports whether every input of tx unlocks the output it spends.
+// An input spending a transaction missing from prevTxs fails.
+func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+
+	checks, err := tx.inputChecks(prevTxs)
+	if err != nil {
+		return false
+	}
+
+	return verifyInputs(checks, VerifiedInputs) == nil
 }
 
 func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("-- Transaction %x: ", tx.Id))
+	if tx.HasWitness() {
+		lines = append(lines, fmt.Sprintf("     WitnessHash: %x", tx.WitnessHash()))
+	}
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     LockTime: %d", tx.LockTime))
+	}
 	for inId, in := range tx.Inputs {
 		lines = append(lines, fmt.Sprintf("     Input %d:", inId))
 		lines = append(lines, fmt.Sprintf("       TxID: %x", in.Id))
 		lines = append(lines, fmt.Sprintf("       Out: %d", in.Out))
-		lines = append(lines, fmt.Sprintf("       Sig: %x", in.Signature))
-		lines = append(lines, fmt.Sprintf("       Pub: %x", in.PubKey))
+		if len(in.Script) > 0 || len(in.Witness) == 0 {
+			lines = append(lines, fmt.Sprintf("       Script: %s", in.Script))
+		}
+		for _, item := range in.Witness {
+			lines = append(lines, fmt.Sprintf("       Witness: %x", item))
+		}
+		if in.Sequence != MaxSequence {
+			lines = append(lines, fmt.Sprintf("       Sequence: %#x", in.Sequence))
+		}
 	}
 
 	for outId, out := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("     Output %d:", outId))
-		lines = append(lines, fmt.Sprintf("       Value: %d", out.Value))
-		lines = append(lines, fmt.Sprintf("       PubHash: %x", out.PubKeyHash))
+		lines = append(lines, fmt.Sprintf("       Value: %s", out.Value))
+		lines = append(lines, fmt.Sprintf("       Script: %s", out.Script))
+		if out.Script.IsDataCarrier() {
+			lines = append(lines, fmt.Sprintf("       Data: %s", formatPayload(out.Script.DataPayload())))
+		}
 	}
 
 	return strings.Join(lines, "\n")
 }
+
+func formatPayload(payload []byte) string {
+	if utf8.Valid(payload) {
+		printable := true
+		for _, r := range string(payload) {
+			if !unicode.IsPrint(r) {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return fmt.Sprintf("%q", payload)
+		}
+	}
+
+	return hex.EncodeToString(payload)
+}
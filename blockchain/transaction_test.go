@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/goozt/seashell/wallet"
+)
+
+// signedSpend pays the first output of a coinbase to w and returns it with
+// a transaction spending it, signed by w.
+func signedSpend(t *testing.T, w *wallet.Wallet) (*Transaction, *Transaction) {
+	t.Helper()
+
+	prevTx := CoinbaseTx(string(w.Address()), "")
+	tx := &Transaction{
+		Inputs:  []TxInput{{Id: prevTx.Id, Out: 0, Sequence: MaxSequence}},
+		Outputs: []TxOutput{*NewTxOutput(Coin, testAddress(4))},
+	}
+	tx.SetID()
+
+	if err := tx.Sign(*w, map[string]Transaction{hex.EncodeToString(prevTx.Id): *prevTx}); err != nil {
+		t.Fatal(err)
+	}
+
+	return prevTx, tx
+}
+
+func TestVerifyInputKeyTypes(t *testing.T) {
+	for _, keyType := range []wallet.KeyType{wallet.P256, wallet.Ed25519} {
+		w := wallet.NewWallet(keyType)
+		prevTx, tx := signedSpend(t, w)
+
+		if err := tx.VerifyInput(0, prevTx.Outputs[0]); err != nil {
+			t.Errorf("key type %d: %v", keyType, err)
+		}
+		if got := prevTx.Outputs[0].Script.Address(); got != string(w.Address()) {
+			t.Errorf("key type %d: output address %s, want %s", keyType, got, w.Address())
+		}
+	}
+}
+
+func TestVerifyMissingPreviousTransaction(t *testing.T) {
+	prevTx, tx := signedSpend(t, wallet.NewWallet(wallet.P256))
+
+	if !tx.Verify(map[string]Transaction{hex.EncodeToString(prevTx.Id): *prevTx}) {
+		t.Fatal("valid spend failed to verify")
+	}
+	if tx.Verify(map[string]Transaction{}) {
+		t.Error("spend of a missing transaction verified")
+	}
+}
+
+func TestVerifyInputRejectsUnlockingScript(t *testing.T) {
+	prevTx, tx := signedSpend(t, wallet.NewWallet(wallet.P256))
+	id := tx.Hash()
+
+	// Moving the witness into Script keeps the signature valid but would
+	// change the id.
+	in := &tx.Inputs[0]
+	in.Script = NewScriptBuilder().AddData(in.Witness[0]).AddData(in.Witness[1]).Script()
+	in.Witness = nil
+
+	if err := tx.VerifyInput(0, prevTx.Outputs[0]); err == nil {
+		t.Fatalf("input unlocking in its script was accepted, id %x became %x", id, tx.Hash())
+	}
+}
+
+func TestRawTransactionSignsWithSpentOutputs(t *testing.T) {
+	w := wallet.NewWallet(wallet.P256)
+	prevTx, tx := signedSpend(t, w)
+	tx.Inputs[0].Witness = nil
+
+	rt := RawTransaction{Tx: *tx, PrevOutputs: []TxOutput{prevTx.Outputs[0]}}
+	if err := rt.Tx.Sign(*w, rt.PreviousTransactions()); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Tx.VerifyInput(0, prevTx.Outputs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// A signer told the output is worth less, making the fee look smaller,
+	// signs a spend of an output that does not exist.
+	rt.PrevOutputs[0].Value = Coin
+	if err := rt.Tx.Sign(*w, rt.PreviousTransactions()); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Tx.VerifyInput(0, prevTx.Outputs[0]); err == nil {
+		t.Error("signature for an understated spent value was accepted")
+	}
+}
@@ -7,18 +7,23 @@ import (
 )
 
 type TxOutput struct {
-	Value      int
-	PubKeyHash []byte
+	Value  Amount
+	Script Script
 }
 
+// TxInput spends a previous output. Signatures and keys go in Witness,
+// which the transaction id does not cover, so relaying nodes cannot change
+// the id by re-encoding them. Script is empty except in coinbase inputs,
+// where it carries the coinbase data.
 type TxInput struct {
-	Id        []byte
-	Out       int
-	Signature []byte
-	PubKey    []byte
+	Id       []byte
+	Out      int
+	Script   Script
+	Sequence uint32
+	Witness  [][]byte
 }
 
-func NewTxOutput(value int, address string) *TxOutput {
+func NewTxOutput(value Amount, address string) *TxOutput {
 	txo := &TxOutput{value, nil}
 	txo.Lock([]byte(address))
 
@@ -26,17 +31,17 @@ func NewTxOutput(value int, address string) *TxOutput {
 }
 
 func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := wallet.PublicKeyHash(in.PubKey)
-
-	return bytes.Equal(lockingHash, pubKeyHash)
+	return len(in.Witness) == 2 && bytes.Equal(wallet.PublicKeyHash(in.Witness[1]), pubKeyHash)
 }
 
 func (out *TxOutput) Lock(address []byte) {
-	pubKeyHash := wallet.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-wallet.ChecksumLength]
-	out.PubKeyHash = pubKeyHash
+	out.Script = AddressScript(string(address))
 }
 
 func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Equal(out.PubKeyHash, pubKeyHash)
+	if out.Script.IsP2SH() {
+		return bytes.Equal(out.Script.ScriptHash(), pubKeyHash)
+	}
+
+	return bytes.Equal(out.Script.PubKeyHash(), pubKeyHash)
 }
@@ -0,0 +1,146 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"crypto/sha256"
+)
+
+const maxSignatureCacheEntries = 100000
+
+// SignatureCache remembers inputs whose scripts already verified, so a
+// transaction checked once is not checked again when it is mined. Entries
+// are keyed on the signed transaction together with the spent output.
+type SignatureCache struct {
+	mu         sync.RWMutex
+	entries    map[[32]byte]struct{}
+	maxEntries int
+}
+
+var VerifiedInputs = NewSignatureCache(maxSignatureCacheEntries)
+
+func NewSignatureCache(maxEntries int) *SignatureCache {
+	return &SignatureCache{entries: make(map[[32]byte]struct{}), maxEntries: maxEntries}
+}
+
+func (c *SignatureCache) Contains(key [32]byte) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Add stores key, dropping an arbitrary entry when the cache is full.
+func (c *SignatureCache) Add(key [32]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		for old := range c.entries {
+			delete(c.entries, old)
+			break
+		}
+	}
+	c.entries[key] = struct{}{}
+}
+
+type inputCheck struct {
+	tx      *Transaction
+	inId    int
+	prevOut TxOutput
+	key     [32]byte
+}
+
+func (c inputCheck) run(cache *SignatureCache) error {
+	if cache.Contains(c.key) {
+		return nil
+	}
+
+	if err := c.tx.VerifyInput(c.inId, c.prevOut); err != nil {
+		return fmt.Errorf("invalid transaction %x: input %d: %v", c.tx.Id, c.inId, err)
+	}
+
+	cache.Add(c.key)
+	return nil
+}
+
+func verifiedInputKey(witnessHash []byte, inId int, prevOut TxOutput) [32]byte {
+	var number [8]byte
+
+	data := append([]byte{}, witnessHash...)
+	binary.BigEndian.PutUint32(number[:4], uint32(inId))
+	data = append(data, number[:4]...)
+	binary.BigEndian.PutUint64(number[:], uint64(prevOut.Value))
+	data = append(data, number[:]...)
+	data = append(data, prevOut.Script...)
+
+	return sha256.Sum256(data)
+}
+
+// inputChecks pairs every input of tx with the output it spends.
+func (tx *Transaction) inputChecks(prevTxs map[string]Transaction) ([]inputCheck, error) {
+	var checks []inputCheck
+
+	witnessHash := tx.WitnessHash()
+
+	for inId, in := range tx.Inputs {
+		prevTx, ok := prevTxs[hex.EncodeToString(in.Id)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTx.Outputs) {
+			return nil, fmt.Errorf("invalid transaction %x: input %d spends unknown output %x:%d", tx.Id, inId, in.Id, in.Out)
+		}
+
+		prevOut := prevTx.Outputs[in.Out]
+		checks = append(checks, inputCheck{tx, inId, prevOut, verifiedInputKey(witnessHash, inId, prevOut)})
+	}
+
+	return checks, nil
+}
+
+// verifyInputs runs the script checks on a pool of GOMAXPROCS workers and
+// returns the first failure, after which no further checks are started.
+func verifyInputs(checks []inputCheck, cache *SignatureCache) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(checks) {
+		workers = len(checks)
+	}
+
+	jobs := make(chan inputCheck)
+	failed := make(chan struct{})
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for check := range jobs {
+				if err := check.run(cache); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, check := range checks {
+		select {
+		case jobs <- check:
+		case <-failed:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
@@ -1,9 +1,16 @@
 package cli
 
 import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/goozt/seashell/blockchain"
 	"github.com/goozt/seashell/wallet"
@@ -27,44 +34,300 @@ func (cli *CommandLine) balance(address string) {
 	chain := blockchain.ContinueBlockChain(false, address)
 	defer chain.Close()
 
-	balance := 0
+	var balance blockchain.Amount
 	pubKeyHash := wallet.Base58Decode([]byte(address))
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-wallet.ChecksumLength]
 	UTXOs := chain.FindUTXO(pubKeyHash)
 
 	for _, out := range UTXOs {
-		balance += out.Value
+		var err error
+		if balance, err = balance.Add(out.Value); err != nil {
+			log.Fatalln(err)
+		}
 	}
 
-	fmt.Printf("Balance of %s: %d\n", address, balance)
+	fmt.Printf("Balance of %s: %s\n", address, balance)
 }
 
-func (cli *CommandLine) send(from, to string, amount int) {
+func (cli *CommandLine) send(from, to string, amount blockchain.Amount, strategy string, lockTime uint, memo string, fee blockchain.FeeRate, replaceable bool, mine string) {
 	if !wallet.ValidateAddress(from) {
 		log.Fatalln("from address is not valid")
 	}
 	if !wallet.ValidateAddress(to) {
 		log.Fatalln("to address is not valid")
 	}
+	selector, err := blockchain.NewCoinSelector(strategy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	pool := loadMempool(chain)
+
+	options := blockchain.SendOptions{Selector: selector, LockTime: uint32(lockTime), Memo: []byte(memo), FeeRate: feeRate(pool, fee), Replaceable: replaceable}
+	tx := blockchain.NewTransaction(from, to, amount, pool, options)
+	broadcast(pool, tx, mine)
+}
+
+func (cli *CommandLine) sendMany(from []string, payments []blockchain.Payment, strategy string, fee blockchain.FeeRate, replaceable bool, mine string) {
+	for _, address := range from {
+		if !wallet.ValidateAddress(address) {
+			log.Fatalf("from address %s is not valid\n", address)
+		}
+	}
+	for _, payment := range payments {
+		if !wallet.ValidateAddress(payment.Address) {
+			log.Fatalf("to address %s is not valid\n", payment.Address)
+		}
+	}
+
+	selector, err := blockchain.NewCoinSelector(strategy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	pool := loadMempool(chain)
+
+	tx := blockchain.NewPaymentTransaction(from, payments, pool, blockchain.SendOptions{Selector: selector, FeeRate: feeRate(pool, fee), Replaceable: replaceable})
+	broadcast(pool, tx, mine)
+}
+
+func (cli *CommandLine) bumpFee(id string, fee blockchain.FeeRate, mine string) {
+	txId, err := hex.DecodeString(id)
+	if err != nil {
+		log.Fatalln("transaction id is not valid hex")
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	pool := loadMempool(chain)
+
+	tx, err := pool.BumpFee(txId, fee)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Replacing transaction %x\n", txId)
+	broadcast(pool, tx, mine)
+}
+
+func (cli *CommandLine) childPaysForParent(id string, fee blockchain.FeeRate, mine string) {
+	txId, err := hex.DecodeString(id)
+	if err != nil {
+		log.Fatalln("transaction id is not valid hex")
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	pool := loadMempool(chain)
+
+	tx, err := pool.NewChildPaysForParent(txId, feeRate(pool, fee))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	broadcast(pool, tx, mine)
+
+	if entry, ok := pool.Entry(txId); ok {
+		fmt.Printf("Transaction %x now has an effective fee rate of %s\n", txId, pool.EffectiveFeeRate(entry))
+	}
+}
+
+func (cli *CommandLine) estimateFee(blocks int) {
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	rate, err := loadMempool(chain).EstimateFee(blocks)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Estimated fee rate to be mined within %d blocks: %s\n", blocks, rate)
+}
+
+// feeRate returns fee, or when it is zero the estimate for the default
+// target, falling back to blockchain.FallbackFeeRate or the minimum fee
+// rate of the pool without one.
+func feeRate(pool *blockchain.Mempool, fee blockchain.FeeRate) blockchain.FeeRate {
+	if fee != 0 {
+		return fee
+	}
+
+	estimate, err := pool.EstimateFee(blockchain.DefaultConfirmTarget)
+	if err != nil {
+		estimate = blockchain.FallbackFeeRate
+		if min := pool.MinFee(); estimate < min {
+			estimate = min
+		}
+	}
+
+	return estimate
+}
+
+func (cli *CommandLine) mempoolInfo() {
 	chain := blockchain.ContinueBlockChain(false, "")
 	defer chain.Close()
 
-	tx := blockchain.NewTransaction(from, to, amount, chain)
-	chain.AddBlock([]*blockchain.Transaction{tx})
+	info := loadMempool(chain).Info()
 
-	fmt.Println("Added new block")
+	fmt.Printf("Transactions: %d\n", info.Count)
+	fmt.Printf("Bytes: %d of %d\n", info.Bytes, info.MaxBytes)
+	fmt.Printf("Minimum fee rate: %s\n", info.MinFee)
+	if info.Oldest != nil {
+		accepted := time.Unix(info.Oldest.Time, 0)
+		fmt.Printf("Oldest: %x, added %s (%s ago)\n", info.Oldest.Tx.Id, accepted.Format(time.RFC3339), time.Since(accepted).Round(time.Second))
+	}
+	fmt.Printf("Orphans: %d\n", info.Orphans)
 }
 
-func (cli *CommandLine) list() {
+func (cli *CommandLine) mine(address string) {
+	if !wallet.ValidateAddress(address) {
+		log.Fatalln("address is not valid")
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	minePool(loadMempool(chain), address)
+}
+
+func loadMempool(chain *blockchain.BlockChain) *blockchain.Mempool {
+	pool, err := blockchain.NewMempool(chain, loadPolicy())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return pool
+}
+
+// broadcast queues tx in the memory pool and with a mine address set mines
+// the pool right away.
+func broadcast(pool *blockchain.Mempool, tx *blockchain.Transaction, mine string) {
+	if mine != "" && !wallet.ValidateAddress(mine) {
+		log.Fatalln("mine address is not valid")
+	}
+
+	entry, err := pool.Add(tx)
+	if orphan, ok := err.(*blockchain.MissingParentsError); ok {
+		fmt.Println(orphan)
+		return
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Added transaction %x to the memory pool paying %s (%s)\n", tx.Id, entry.Fee, entry.FeeRate())
+
+	if mine != "" {
+		minePool(pool, mine)
+	}
+}
+
+func minePool(pool *blockchain.Mempool, address string) {
+	template, err := pool.Mine(address)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	block := template.Block
+	fmt.Printf("Mined block %x at height %d with %d transactions and %s in fees\n", block.Hash, block.Height, len(block.Transactions), template.Fees)
+}
+
+func (cli *CommandLine) getTransaction(id string, asJSON bool) {
+	txId, err := hex.DecodeString(id)
+	if err != nil {
+		log.Fatalln("transaction id is not valid hex")
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	pool := loadMempool(chain)
+	if entry, ok := pool.Entry(txId); ok {
+		if asJSON {
+			printJSON(entry.Tx)
+			return
+		}
+
+		fmt.Println("Unconfirmed, in the memory pool")
+		fmt.Printf("  Fee: %s (%s)\n", entry.Fee, entry.FeeRate())
+		fmt.Printf("  Package fee rate: %s\n", pool.PackageFeeRate(entry))
+		fmt.Printf("  Effective fee rate: %s\n", pool.EffectiveFeeRate(entry))
+		fmt.Println(entry.Tx)
+		return
+	}
+
+	tx, block, err := chain.FindTransactionBlock(txId)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if asJSON {
+		printJSON(tx)
+		return
+	}
+
+	fmt.Printf("Block %x\n", block.Hash)
+	fmt.Printf("  Height: %d\n", block.Height)
+	fmt.Println(tx)
+}
+
+func (cli *CommandLine) importTransaction(file string, mine string) {
+	var content []byte
+	var err error
+
+	if file == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(file)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var tx blockchain.Transaction
+	if err := json.Unmarshal(content, &tx); err != nil {
+		log.Fatalf("%s is not a transaction: %v\n", file, err)
+	}
+
+	submitTransaction(&tx, mine)
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Println(string(data))
+}
+
+func (cli *CommandLine) list(asJSON bool) {
 	chain := blockchain.ContinueBlockChain(false, "")
 	defer chain.Close()
 	iter := chain.Iterator()
 	for {
 		block := iter.Next()
 
+		if asJSON {
+			printJSON(block)
+			if len(block.PrevHash) == 0 {
+				break
+			}
+			continue
+		}
+
 		fmt.Printf("Block %x\n", block.Hash)
 		fmt.Printf("  Timestamp: %d\n", block.Timestamp)
 		fmt.Printf("  PreviousHash: %x\n", block.PrevHash)
+		fmt.Printf("  Height: %d\n", block.Height)
 
 		pow := blockchain.NewProof(block)
 		fmt.Printf("  Valid PoW: %s\n", strconv.FormatBool(pow.Validate()))
@@ -77,3 +340,77 @@ func (cli *CommandLine) list() {
 		}
 	}
 }
+
+func parsePayments(spec string) ([]blockchain.Payment, error) {
+	var payments []blockchain.Payment
+
+	for _, entry := range strings.Split(spec, ",") {
+		address, amount, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			return nil, fmt.Errorf("payment %q is not in ADDRESS:AMOUNT form", entry)
+		}
+
+		payment, err := newPayment(address, amount)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+func readPaymentsFile(path string) ([]blockchain.Payment, error) {
+	var payments []blockchain.Payment
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	first := 0
+	if len(records) > 0 && isPaymentsHeader(records[0]) {
+		first = 1
+	}
+
+	for row := first; row < len(records); row++ {
+		payment, err := newPayment(records[row][0], records[row][1])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, row+1, err)
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+// isPaymentsHeader tells a header row such as "address,amount" from a
+// payment: its amount is not a number and its address is not an address.
+// A first row that is only a malformed payment is reported as such.
+func isPaymentsHeader(record []string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+
+	return err != nil && !wallet.ValidateAddress(strings.TrimSpace(record[0]))
+}
+
+func newPayment(address, amount string) (blockchain.Payment, error) {
+	value, err := blockchain.ParseAmount(amount)
+	if err != nil {
+		return blockchain.Payment{}, err
+	}
+	if value == 0 {
+		return blockchain.Payment{}, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	return blockchain.Payment{Address: strings.TrimSpace(address), Amount: value}, nil
+}
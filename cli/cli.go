@@ -3,22 +3,53 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"log"
+	"math"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/goozt/seashell/blockchain"
+	"github.com/goozt/seashell/wallet"
 )
 
 type CommandLine struct{}
 
+const feeUsage = "Fee rate in coins per 1000 bytes, e.g. 0.0001, by default the estimate"
+const replaceableUsage = "Let the transaction be replaced with bumpfee until it is mined"
+const mineUsage = "Address to reward for mining a block with the memory pool right away"
+
 func (cli *CommandLine) usage() {
 	fmt.Println("Usage:")
 	fmt.Println(" balance -a ADDRESS")
 	fmt.Println(" create -a ADDRESS")
-	fmt.Println(" send -from ADDRESS -to ADDRESS -amount VALUE")
-	fmt.Println(" list")
-	fmt.Println(" wallet")
+	fmt.Println(" send -from ADDRESS -to ADDRESS -amount VALUE [-strategy bnb|largest|smallest|random] [-locktime HEIGHT|UNIXTIME] [-memo TEXT] [-fee RATE] [-replaceable=false] [-mine ADDRESS]")
+	fmt.Println(" sendmany -from ADDRESS[,ADDRESS...] (-to ADDRESS:VALUE,... | -file PAYOUTS.csv) [-strategy bnb|largest|smallest|random] [-fee RATE] [-replaceable=false] [-mine ADDRESS]")
+	fmt.Println(" bumpfee -id TXID [-fee RATE] [-mine ADDRESS]")
+	fmt.Println(" cpfp -id TXID [-fee RATE] [-mine ADDRESS]")
+	fmt.Println(" estimatefee [-blocks N]")
+	fmt.Println(" mine -a ADDRESS")
+	fmt.Println(" mempoolinfo")
+	fmt.Println(" policy [-dustrelayfee RATE] [-datacarriersize BYTES] [-maxinputs N] [-maxtxsize BYTES] [-maxwitnessitems N] [-maxwitnessitemsize BYTES]")
+	fmt.Println("        [-acceptnonstandard] [-minrelayfee RATE] [-maxmempool BYTES] [-mempoolexpiry HOURS] [-reset]")
+	fmt.Println(" startnode -port PORT [-peers HOST:PORT,...] [-miner ADDRESS]")
+	fmt.Println(" list [-json]")
+	fmt.Println(" gettx -id TXID [-json]")
+	fmt.Println(" importtx -file TX.json [-mine ADDRESS]")
+	fmt.Println(" createrawtx -in TXID:INDEX[,TXID:INDEX...] -to ADDRESS:VALUE[,...] [-locktime HEIGHT|UNIXTIME] [-memo TEXT]")
+	fmt.Println(" signrawtx -tx HEX")
+	fmt.Println(" decoderawtx -tx HEX [-json]")
+	fmt.Println(" submitrawtx -tx HEX [-mine ADDRESS]")
+	fmt.Println(" wallet [-type p256|ed25519]")
 	fmt.Println(" walletlist")
+	fmt.Println(" pubkey -a ADDRESS")
+	fmt.Println(" multisig-create -m REQUIRED -keys PUBKEY,PUBKEY,...")
+	fmt.Println(" multisig-spend -from MULTISIG_ADDRESS -to ADDRESS -amount VALUE -out FILE [-strategy bnb|largest|smallest|random]")
+	fmt.Println(" multisig-sign -in FILE -a SIGNER_ADDRESS")
+	fmt.Println(" multisig-send -in FILE [-mine ADDRESS]")
+	fmt.Println(" htlc-create -from ADDRESS -to ADDRESS -amount VALUE -timeout BLOCKS [-hash SHA256] [-mine ADDRESS]")
+	fmt.Println(" htlc-claim -id TXID -out INDEX -preimage SECRET [-mine ADDRESS]")
+	fmt.Println(" htlc-refund -id TXID -out INDEX [-mine ADDRESS]")
 }
 
 func (cli *CommandLine) validateArgs() {
@@ -34,15 +65,120 @@ func (cli *CommandLine) Run() {
 	createCmd := flag.NewFlagSet("create", flag.ExitOnError)
 	balanceCmd := flag.NewFlagSet("balance", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+	bumpFeeCmd := flag.NewFlagSet("bumpfee", flag.ExitOnError)
+	cpfpCmd := flag.NewFlagSet("cpfp", flag.ExitOnError)
+	estimateFeeCmd := flag.NewFlagSet("estimatefee", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	mempoolInfoCmd := flag.NewFlagSet("mempoolinfo", flag.ExitOnError)
+	policyCmd := flag.NewFlagSet("policy", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
 	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
+	getTxCmd := flag.NewFlagSet("gettx", flag.ExitOnError)
+	importTxCmd := flag.NewFlagSet("importtx", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtx", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtx", flag.ExitOnError)
+	decodeRawTxCmd := flag.NewFlagSet("decoderawtx", flag.ExitOnError)
+	submitRawTxCmd := flag.NewFlagSet("submitrawtx", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("wallet", flag.ExitOnError)
 	listaddrsCmd := flag.NewFlagSet("walletlist", flag.ExitOnError)
+	pubKeyCmd := flag.NewFlagSet("pubkey", flag.ExitOnError)
+	multisigCreateCmd := flag.NewFlagSet("multisig-create", flag.ExitOnError)
+	multisigSpendCmd := flag.NewFlagSet("multisig-spend", flag.ExitOnError)
+	multisigSignCmd := flag.NewFlagSet("multisig-sign", flag.ExitOnError)
+	multisigSendCmd := flag.NewFlagSet("multisig-send", flag.ExitOnError)
+	htlcCreateCmd := flag.NewFlagSet("htlc-create", flag.ExitOnError)
+	htlcClaimCmd := flag.NewFlagSet("htlc-claim", flag.ExitOnError)
+	htlcRefundCmd := flag.NewFlagSet("htlc-refund", flag.ExitOnError)
 
 	createAddress := createCmd.String("a", "", "Address to create blockchain")
 	balanceAddress := balanceCmd.String("a", "", "Address to get balance from blockchain")
 	sendFrom := sendCmd.String("from", "", "Address of sender")
 	sendTo := sendCmd.String("to", "", "Address of receiver")
-	sendAmount := sendCmd.Int("amount", 0, "Amount sent")
+	sendAmount := new(blockchain.Amount)
+	sendCmd.Var(sendAmount, "amount", "Amount sent, e.g. 1.25")
+	sendStrategy := sendCmd.String("strategy", "bnb", "Coin selection strategy: "+strings.Join(blockchain.CoinSelectors, ", "))
+	sendMemo := sendCmd.String("memo", "", fmt.Sprintf("Data of up to %d bytes stored in an unspendable output", blockchain.MaxDataCarrierSize))
+	sendLockTime := sendCmd.Uint("locktime", 0, "Block height, or unix time from 500000000 on, before which the transaction cannot be mined")
+	sendFee := new(blockchain.FeeRate)
+	sendCmd.Var(sendFee, "fee", feeUsage)
+	sendReplaceable := sendCmd.Bool("replaceable", true, replaceableUsage)
+	sendMine := sendCmd.String("mine", "", mineUsage)
+	sendManyFrom := sendManyCmd.String("from", "", "Comma separated addresses funding the payments")
+	sendManyTo := sendManyCmd.String("to", "", "Comma separated ADDRESS:VALUE payments")
+	sendManyFile := sendManyCmd.String("file", "", "CSV file of ADDRESS,VALUE payments")
+	sendManyStrategy := sendManyCmd.String("strategy", "bnb", "Coin selection strategy: "+strings.Join(blockchain.CoinSelectors, ", "))
+	sendManyFee := new(blockchain.FeeRate)
+	sendManyCmd.Var(sendManyFee, "fee", feeUsage)
+	sendManyReplaceable := sendManyCmd.Bool("replaceable", true, replaceableUsage)
+	sendManyMine := sendManyCmd.String("mine", "", mineUsage)
+	bumpFeeId := bumpFeeCmd.String("id", "", "Transaction id of the memory pool transaction to replace")
+	bumpFeeRate := new(blockchain.FeeRate)
+	bumpFeeCmd.Var(bumpFeeRate, "fee", "Fee rate in coins per 1000 bytes, by default the least that replaces the transaction")
+	bumpFeeMine := bumpFeeCmd.String("mine", "", mineUsage)
+	cpfpId := cpfpCmd.String("id", "", "Transaction id of the memory pool transaction paying the wallet")
+	cpfpRate := new(blockchain.FeeRate)
+	cpfpCmd.Var(cpfpRate, "fee", "Fee rate in coins per 1000 bytes for the transaction and the child together, by default the estimate")
+	cpfpMine := cpfpCmd.String("mine", "", mineUsage)
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", blockchain.DefaultConfirmTarget, "Number of blocks to get mined within")
+	mineAddress := mineCmd.String("a", "", "Address to reward for the block")
+	var policyChanges blockchain.Policy
+	policyCmd.Var(&policyChanges.DustRelayFee, "dustrelayfee", "Fee rate in coins per 1000 bytes at which spending an output costs more than it is worth")
+	policyCmd.IntVar(&policyChanges.MaxDataCarrierSize, "datacarriersize", 0, "Largest data output in bytes")
+	policyCmd.IntVar(&policyChanges.MaxInputs, "maxinputs", 0, "Most inputs a transaction may have")
+	policyCmd.IntVar(&policyChanges.MaxTxSize, "maxtxsize", 0, "Largest transaction in bytes")
+	policyCmd.IntVar(&policyChanges.MaxWitnessItems, "maxwitnessitems", 0, "Most witness items an input may have")
+	policyCmd.IntVar(&policyChanges.MaxWitnessItemSize, "maxwitnessitemsize", 0, "Largest witness item in bytes, except P2SH redeem scripts")
+	policyCmd.BoolVar(&policyChanges.AcceptNonStandard, "acceptnonstandard", false, "Accept transactions that break the other rules")
+	policyCmd.Var(&policyChanges.MinRelayFee, "minrelayfee", "Least fee rate in coins per 1000 bytes of transactions in the memory pool")
+	policyCmd.IntVar(&policyChanges.MaxMempoolSize, "maxmempool", 0, "Largest size of the memory pool in bytes")
+	policyCmd.IntVar(&policyChanges.MempoolExpiry, "mempoolexpiry", 0, "Hours a transaction stays in the memory pool without being mined")
+	policyReset := policyCmd.Bool("reset", false, "Go back to the default policy")
+	startNodePort := startNodeCmd.Int("port", 0, "TCP port to listen on for peers")
+	startNodePeers := startNodeCmd.String("peers", "", "Comma separated HOST:PORT nodes to connect to")
+	startNodeMiner := startNodeCmd.String("miner", "", "Address to reward for mining the memory pool whenever it holds transactions")
+	listJSON := listCmd.Bool("json", false, "Print blocks as JSON")
+	getTxId := getTxCmd.String("id", "", "Transaction id")
+	getTxJSON := getTxCmd.Bool("json", false, "Print the transaction as JSON")
+	importTxFile := importTxCmd.String("file", "", "JSON transaction to add to the memory pool, - for stdin")
+	importTxMine := importTxCmd.String("mine", "", mineUsage)
+	createRawTxIn := createRawTxCmd.String("in", "", "Comma separated TXID:INDEX outputs to spend")
+	createRawTxTo := createRawTxCmd.String("to", "", "Comma separated ADDRESS:VALUE payments")
+	createRawTxLockTime := createRawTxCmd.Uint("locktime", 0, "Block height, or unix time from 500000000 on, before which the transaction cannot be mined")
+	createRawTxMemo := createRawTxCmd.String("memo", "", fmt.Sprintf("Data of up to %d bytes stored in an unspendable output", blockchain.MaxDataCarrierSize))
+	signRawTxHex := signRawTxCmd.String("tx", "", "Hex encoded raw transaction from createrawtx, signed with the spent outputs it carries")
+	decodeRawTxHex := decodeRawTxCmd.String("tx", "", "Hex encoded transaction to decode")
+	decodeRawTxJSON := decodeRawTxCmd.Bool("json", false, "Print the transaction as JSON")
+	submitRawTxHex := submitRawTxCmd.String("tx", "", "Hex encoded signed transaction to add to the memory pool")
+	submitRawTxMine := submitRawTxCmd.String("mine", "", mineUsage)
+	walletType := createWalletCmd.String("type", "p256", "Key type: "+strings.Join(wallet.KeyTypes, ", "))
+	pubKeyAddress := pubKeyCmd.String("a", "", "Wallet address to show the public key of")
+	multisigRequired := multisigCreateCmd.Int("m", 0, "Number of signatures required")
+	multisigKeys := multisigCreateCmd.String("keys", "", "Comma separated hex public keys")
+	multisigSpendFrom := multisigSpendCmd.String("from", "", "Multisig address of sender")
+	multisigSpendTo := multisigSpendCmd.String("to", "", "Address of receiver")
+	multisigSpendAmount := new(blockchain.Amount)
+	multisigSpendCmd.Var(multisigSpendAmount, "amount", "Amount sent, e.g. 1.25")
+	multisigSpendStrategy := multisigSpendCmd.String("strategy", "bnb", "Coin selection strategy: "+strings.Join(blockchain.CoinSelectors, ", "))
+	multisigSpendOut := multisigSpendCmd.String("out", "", "File to write the unsigned spend to")
+	multisigSignIn := multisigSignCmd.String("in", "", "File with the partially signed spend")
+	multisigSigner := multisigSignCmd.String("a", "", "Wallet address of the signing key")
+	multisigSendIn := multisigSendCmd.String("in", "", "File with the fully signed spend")
+	multisigSendMine := multisigSendCmd.String("mine", "", mineUsage)
+	htlcFrom := htlcCreateCmd.String("from", "", "Address funding the HTLC and receiving the refund")
+	htlcTo := htlcCreateCmd.String("to", "", "Address that can claim the HTLC with the secret")
+	htlcAmount := new(blockchain.Amount)
+	htlcCreateCmd.Var(htlcAmount, "amount", "Amount locked, e.g. 1.25")
+	htlcHash := htlcCreateCmd.String("hash", "", "Hex sha256 hash of the secret, a new secret is generated if empty")
+	htlcTimeout := htlcCreateCmd.Uint("timeout", 0, "Number of blocks from the current height after which the funds can be refunded")
+	htlcCreateMine := htlcCreateCmd.String("mine", "", mineUsage)
+	htlcClaimId := htlcClaimCmd.String("id", "", "Transaction id of the HTLC")
+	htlcClaimOut := htlcClaimCmd.Int("out", 0, "Output index of the HTLC")
+	htlcPreimage := htlcClaimCmd.String("preimage", "", "Hex secret whose sha256 is the HTLC hash")
+	htlcClaimMine := htlcClaimCmd.String("mine", "", mineUsage)
+	htlcRefundId := htlcRefundCmd.String("id", "", "Transaction id of the HTLC")
+	htlcRefundOut := htlcRefundCmd.Int("out", 0, "Output index of the HTLC")
+	htlcRefundMine := htlcRefundCmd.String("mine", "", mineUsage)
 
 	switch os.Args[1] {
 	case "create":
@@ -54,15 +190,81 @@ func (cli *CommandLine) Run() {
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		blockchain.HandleFatalErrors(err)
+	case "sendmany":
+		err := sendManyCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "bumpfee":
+		err := bumpFeeCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "cpfp":
+		err := cpfpCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "estimatefee":
+		err := estimateFeeCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "mine":
+		err := mineCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "mempoolinfo":
+		err := mempoolInfoCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "policy":
+		err := policyCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
 	case "list":
 		err := listCmd.Parse(os.Args[2:])
 		blockchain.HandleFatalErrors(err)
+	case "gettx":
+		err := getTxCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "importtx":
+		err := importTxCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "createrawtx":
+		err := createRawTxCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "signrawtx":
+		err := signRawTxCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "decoderawtx":
+		err := decodeRawTxCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "submitrawtx":
+		err := submitRawTxCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
 	case "wallet":
 		err := createWalletCmd.Parse(os.Args[2:])
 		blockchain.HandleFatalErrors(err)
 	case "walletlist":
 		err := listaddrsCmd.Parse(os.Args[2:])
 		blockchain.HandleFatalErrors(err)
+	case "pubkey":
+		err := pubKeyCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "multisig-create":
+		err := multisigCreateCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "multisig-spend":
+		err := multisigSpendCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "multisig-sign":
+		err := multisigSignCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "multisig-send":
+		err := multisigSendCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "htlc-create":
+		err := htlcCreateCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "htlc-claim":
+		err := htlcClaimCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
+	case "htlc-refund":
+		err := htlcRefundCmd.Parse(os.Args[2:])
+		blockchain.HandleFatalErrors(err)
 	default:
 		cli.usage()
 		runtime.Goexit()
@@ -85,22 +287,222 @@ func (cli *CommandLine) Run() {
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount == 0 {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		if *sendLockTime > math.MaxUint32 {
+			log.Fatalln("locktime is out of range")
+		}
+		if len(*sendMemo) > blockchain.MaxDataCarrierSize {
+			log.Fatalf("memo is longer than %d bytes\n", blockchain.MaxDataCarrierSize)
+		}
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendStrategy, *sendLockTime, *sendMemo, *sendFee, *sendReplaceable, *sendMine)
+	}
+
+	if sendManyCmd.Parsed() {
+		if *sendManyFrom == "" || (*sendManyTo == "") == (*sendManyFile == "") {
+			sendManyCmd.Usage()
+			runtime.Goexit()
+		}
+
+		var payments []blockchain.Payment
+		var err error
+		if *sendManyFile != "" {
+			payments, err = readPaymentsFile(*sendManyFile)
+		} else {
+			payments, err = parsePayments(*sendManyTo)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(payments) == 0 {
+			log.Fatalln("no payments given")
+		}
+
+		cli.sendMany(strings.Split(*sendManyFrom, ","), payments, *sendManyStrategy, *sendManyFee, *sendManyReplaceable, *sendManyMine)
+	}
+
+	if bumpFeeCmd.Parsed() {
+		if *bumpFeeId == "" {
+			bumpFeeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.bumpFee(*bumpFeeId, *bumpFeeRate, *bumpFeeMine)
+	}
+
+	if cpfpCmd.Parsed() {
+		if *cpfpId == "" {
+			cpfpCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.childPaysForParent(*cpfpId, *cpfpRate, *cpfpMine)
+	}
+
+	if estimateFeeCmd.Parsed() {
+		if *estimateFeeBlocks < 1 || *estimateFeeBlocks > blockchain.MaxConfirmTarget {
+			log.Fatalf("blocks must be between 1 and %d\n", blockchain.MaxConfirmTarget)
+		}
+		cli.estimateFee(*estimateFeeBlocks)
+	}
+
+	if mineCmd.Parsed() {
+		if *mineAddress == "" {
+			mineCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.mine(*mineAddress)
+	}
+
+	if mempoolInfoCmd.Parsed() {
+		cli.mempoolInfo()
+	}
+
+	if policyCmd.Parsed() {
+		set := make(map[string]bool)
+		policyCmd.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		cli.policy(policyChanges, set, *policyReset)
+	}
+
+	if startNodeCmd.Parsed() {
+		if *startNodePort <= 0 || *startNodePort > math.MaxUint16 {
+			startNodeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.startNode(*startNodePort, *startNodePeers, *startNodeMiner)
 	}
 
 	if listCmd.Parsed() {
-		cli.list()
+		cli.list(*listJSON)
+	}
+
+	if getTxCmd.Parsed() {
+		if *getTxId == "" {
+			getTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getTransaction(*getTxId, *getTxJSON)
+	}
+
+	if importTxCmd.Parsed() {
+		if *importTxFile == "" {
+			importTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importTransaction(*importTxFile, *importTxMine)
+	}
+
+	if createRawTxCmd.Parsed() {
+		if *createRawTxIn == "" || *createRawTxTo == "" {
+			createRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		if *createRawTxLockTime > math.MaxUint32 {
+			log.Fatalln("locktime does not fit in 32 bits")
+		}
+		if len(*createRawTxMemo) > blockchain.MaxDataCarrierSize {
+			log.Fatalf("memo is longer than %d bytes\n", blockchain.MaxDataCarrierSize)
+		}
+		payments, err := parsePayments(*createRawTxTo)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		cli.createRawTransaction(*createRawTxIn, payments, *createRawTxLockTime, *createRawTxMemo)
+	}
+
+	if signRawTxCmd.Parsed() {
+		if *signRawTxHex == "" {
+			signRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signRawTransaction(*signRawTxHex)
+	}
+
+	if decodeRawTxCmd.Parsed() {
+		if *decodeRawTxHex == "" {
+			decodeRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.decodeRawTransaction(*decodeRawTxHex, *decodeRawTxJSON)
+	}
+
+	if submitRawTxCmd.Parsed() {
+		if *submitRawTxHex == "" {
+			submitRawTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.submitRawTransaction(*submitRawTxHex, *submitRawTxMine)
 	}
 
 	if createWalletCmd.Parsed() {
-		cli.createWallet()
+		cli.createWallet(*walletType)
 	}
 
 	if listaddrsCmd.Parsed() {
 		cli.listAllAddresses()
 	}
+
+	if pubKeyCmd.Parsed() {
+		if *pubKeyAddress == "" {
+			pubKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.publicKey(*pubKeyAddress)
+	}
+
+	if multisigCreateCmd.Parsed() {
+		if *multisigRequired <= 0 || *multisigKeys == "" {
+			multisigCreateCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createMultisig(*multisigRequired, strings.Split(*multisigKeys, ","))
+	}
+
+	if multisigSpendCmd.Parsed() {
+		if *multisigSpendFrom == "" || *multisigSpendTo == "" || *multisigSpendAmount == 0 || *multisigSpendOut == "" {
+			multisigSpendCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.spendMultisig(*multisigSpendFrom, *multisigSpendTo, *multisigSpendAmount, *multisigSpendStrategy, *multisigSpendOut)
+	}
+
+	if multisigSignCmd.Parsed() {
+		if *multisigSignIn == "" || *multisigSigner == "" {
+			multisigSignCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signMultisig(*multisigSignIn, *multisigSigner)
+	}
+
+	if multisigSendCmd.Parsed() {
+		if *multisigSendIn == "" {
+			multisigSendCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendMultisig(*multisigSendIn, *multisigSendMine)
+	}
+
+	if htlcCreateCmd.Parsed() {
+		if *htlcFrom == "" || *htlcTo == "" || *htlcAmount == 0 || *htlcTimeout == 0 {
+			htlcCreateCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createHTLC(*htlcFrom, *htlcTo, *htlcAmount, *htlcHash, *htlcTimeout, *htlcCreateMine)
+	}
+
+	if htlcClaimCmd.Parsed() {
+		if *htlcClaimId == "" || *htlcPreimage == "" {
+			htlcClaimCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.claimHTLC(*htlcClaimId, *htlcClaimOut, *htlcPreimage, *htlcClaimMine)
+	}
+
+	if htlcRefundCmd.Parsed() {
+		if *htlcRefundId == "" {
+			htlcRefundCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.refundHTLC(*htlcRefundId, *htlcRefundOut, *htlcRefundMine)
+	}
 }
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/goozt/seashell/blockchain"
+	"github.com/goozt/seashell/wallet"
+)
+
+func (cli *CommandLine) createHTLC(from, to string, amount blockchain.Amount, hashHex string, timeout uint, mine string) {
+	if !wallet.ValidateAddress(from) || wallet.IsMultisigAddress(from) {
+		log.Fatalln("from address is not valid")
+	}
+	if !wallet.ValidateAddress(to) || wallet.IsMultisigAddress(to) {
+		log.Fatalln("to address is not valid")
+	}
+
+	var hash []byte
+	if hashHex == "" {
+		secret := make([]byte, blockchain.HTLCSecretSize)
+		_, err := rand.Read(secret)
+		blockchain.HandleFatalErrors(err)
+
+		digest := sha256.Sum256(secret)
+		hash = digest[:]
+		fmt.Printf("Secret (keep it until you claim): %x\n", secret)
+	} else {
+		var err error
+		hash, err = hex.DecodeString(hashHex)
+		if err != nil || len(hash) != sha256.Size {
+			log.Fatalln("hash must be a hex encoded sha256 digest")
+		}
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+	pool := loadMempool(chain)
+
+	// The timeout counts from the height of this chain, heights of two chains
+	// in a swap are not comparable.
+	height := uint64(chain.Height()) + uint64(timeout)
+	if height >= blockchain.LockTimeThreshold {
+		log.Fatalln("timeout must be a number of blocks")
+	}
+
+	htlc := blockchain.HTLC{
+		Hash:         hash,
+		RecipientPKH: wallet.AddressHash(to),
+		RefundPKH:    wallet.AddressHash(from),
+		Timeout:      uint32(height),
+	}
+
+	outputs := []blockchain.TxOutput{{Value: amount, Script: htlc.Script()}}
+	tx := blockchain.NewWalletTransaction([]string{from}, outputs, pool, blockchain.SendOptions{FeeRate: feeRate(pool, 0)})
+	broadcast(pool, tx, mine)
+
+	fmt.Printf("Hash: %x\n", hash)
+	fmt.Printf("HTLC output: %x:0, claimable by %s, refundable to %s after height %d\n", tx.Id, to, from, height)
+}
+
+func (cli *CommandLine) claimHTLC(id string, out int, preimageHex string, mine string) {
+	preimage, err := hex.DecodeString(preimageHex)
+	if err != nil {
+		log.Fatalln("preimage is not valid hex")
+	}
+
+	cli.spendHTLC(id, out, mine, func(prevTx *blockchain.Transaction, htlc *blockchain.HTLC, walletDB *wallet.WalletDB, rate blockchain.FeeRate) (*blockchain.Transaction, error) {
+		w, ok := walletDB.FindWallet(htlc.RecipientPKH)
+		if !ok {
+			return nil, fmt.Errorf("the HTLC recipient is not in the wallet")
+		}
+		return blockchain.NewHTLCClaimTransaction(prevTx, out, preimage, w, rate)
+	})
+
+	fmt.Printf("Claimed with preimage %x\n", preimage)
+}
+
+func (cli *CommandLine) refundHTLC(id string, out int, mine string) {
+	cli.spendHTLC(id, out, mine, func(prevTx *blockchain.Transaction, htlc *blockchain.HTLC, walletDB *wallet.WalletDB, rate blockchain.FeeRate) (*blockchain.Transaction, error) {
+		w, ok := walletDB.FindWallet(htlc.RefundPKH)
+		if !ok {
+			return nil, fmt.Errorf("the HTLC refund address is not in the wallet")
+		}
+		return blockchain.NewHTLCRefundTransaction(prevTx, out, w, rate)
+	})
+
+	fmt.Println("Refunded")
+}
+
+type htlcSpender func(*blockchain.Transaction, *blockchain.HTLC, *wallet.WalletDB, blockchain.FeeRate) (*blockchain.Transaction, error)
+
+func (cli *CommandLine) spendHTLC(id string, out int, mine string, spend htlcSpender) {
+	txId, err := hex.DecodeString(id)
+	if err != nil {
+		log.Fatalln("transaction id is not valid hex")
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+	pool := loadMempool(chain)
+
+	prevTx, err := pool.FindTransaction(txId)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if out < 0 || out >= len(prevTx.Outputs) {
+		log.Fatalf("transaction %s has no output %d\n", id, out)
+	}
+	htlc, err := blockchain.ParseHTLCScript(prevTx.Outputs[out].Script)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if pool.IsSpent(txId, out) {
+		log.Fatalln("HTLC output is already spent")
+	}
+
+	walletDB, _ := wallet.CreateWalletDB()
+	tx, err := spend(&prevTx, htlc, walletDB, feeRate(pool, 0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	broadcast(pool, tx, mine)
+}
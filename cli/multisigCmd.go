@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/goozt/seashell/blockchain"
+	"github.com/goozt/seashell/wallet"
+)
+
+func (cli *CommandLine) createMultisig(m int, keys []string) {
+	var pubKeys [][]byte
+
+	for _, key := range keys {
+		pubKey, err := hex.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			log.Fatalf("public key %q is not valid hex\n", key)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	redeemScript, err := blockchain.MultisigScript(m, pubKeys)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	walletDB, _ := wallet.CreateWalletDB()
+	address := walletDB.AddMultisig(redeemScript)
+	walletDB.SaveFile()
+
+	fmt.Printf("New %d-of-%d multisig address is %s\n", m, len(pubKeys), address)
+	fmt.Printf("Redeem script: %x\n", []byte(redeemScript))
+}
+
+func (cli *CommandLine) spendMultisig(from, to string, amount blockchain.Amount, strategy, file string) {
+	if !wallet.ValidateAddress(from) || !wallet.IsMultisigAddress(from) {
+		log.Fatalln("from address is not a valid multisig address")
+	}
+	if !wallet.ValidateAddress(to) {
+		log.Fatalln("to address is not valid")
+	}
+
+	walletDB, _ := wallet.CreateWalletDB()
+	redeemScript, ok := walletDB.Multisigs[from]
+	if !ok {
+		log.Fatalln("multisig address is not in the wallet, create it with multisig-create first")
+	}
+
+	selector, err := blockchain.NewCoinSelector(strategy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	pool := loadMempool(chain)
+
+	payments := []blockchain.Payment{{Address: to, Amount: amount}}
+	pt, err := blockchain.NewMultisigTransaction(redeemScript, payments, pool, blockchain.SendOptions{Selector: selector, FeeRate: feeRate(pool, 0)})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	savePartialTransaction(file, pt)
+
+	fmt.Printf("Unsigned spend written to %s, it needs %d signatures\n", file, pt.Required())
+}
+
+func (cli *CommandLine) signMultisig(file, signer string) {
+	pt := loadPartialTransaction(file)
+
+	walletDB, _ := wallet.CreateWalletDB()
+	w, ok := walletDB.Wallets[signer]
+	if !ok {
+		log.Fatalln("signer address is not in the wallet")
+	}
+
+	if err := pt.Sign(*w); err != nil {
+		log.Fatalln(err)
+	}
+
+	savePartialTransaction(file, pt)
+
+	fmt.Printf("Signed %s, it has %d of %d signatures\n", file, pt.SignatureCount(), pt.Required())
+}
+
+func (cli *CommandLine) sendMultisig(file string, mine string) {
+	pt := loadPartialTransaction(file)
+
+	tx, err := pt.Complete()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	broadcast(loadMempool(chain), tx, mine)
+}
+
+func savePartialTransaction(file string, pt *blockchain.PartialTransaction) {
+	content := hex.EncodeToString(pt.Serialize())
+
+	if err := os.WriteFile(file, []byte(content+"\n"), 0644); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func loadPartialTransaction(file string) *blockchain.PartialTransaction {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	data, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		log.Fatalf("%s is not a partial transaction: %v\n", file, err)
+	}
+
+	pt, err := blockchain.DeserializePartialTransaction(data)
+	if err != nil {
+		log.Fatalf("%s is not a partial transaction: %v\n", file, err)
+	}
+
+	return pt
+}
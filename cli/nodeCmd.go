@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/goozt/seashell/blockchain"
+	"github.com/goozt/seashell/network"
+	"github.com/goozt/seashell/wallet"
+)
+
+// startNode serves the chain of the working directory on port until
+// interrupted. Without a chain the genesis block of the first peer is
+// downloaded.
+func (cli *CommandLine) startNode(port int, peerList, miner string) {
+	if miner != "" && !wallet.ValidateAddress(miner) {
+		log.Fatalln("miner address is not valid")
+	}
+
+	var peers []string
+	if peerList != "" {
+		for _, peer := range strings.Split(peerList, ",") {
+			peers = append(peers, strings.TrimSpace(peer))
+		}
+	}
+
+	var chain *blockchain.BlockChain
+	if blockchain.DbExists() {
+		chain = blockchain.ContinueBlockChain(false, "")
+	} else {
+		if len(peers) == 0 {
+			log.Fatalln("there is no blockchain to serve, create one or give -peers to download it")
+		}
+
+		genesis, err := network.FetchGenesis(peers[0])
+		if err != nil {
+			log.Fatalf("could not download the genesis block from %s: %v", peers[0], err)
+		}
+		chain, err = blockchain.InitBlockChainFromGenesis(genesis)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("Started a blockchain with genesis block %x from %s\n", genesis.Hash, peers[0])
+	}
+	defer chain.Close()
+
+	node := network.NewNode(chain, loadMempool(chain), miner)
+	if err := node.Start(fmt.Sprintf(":%d", port), peers); err != nil {
+		log.Fatalln(err)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+
+	fmt.Println("Stopping the node")
+	node.Close()
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"log"
+
+	"github.com/goozt/seashell/blockchain"
+)
+
+const policyFile = "./db/policy.json"
+
+func loadPolicy() blockchain.Policy {
+	policy, err := blockchain.LoadPolicy(policyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return policy
+}
+
+// policy applies the rules of changes named in set to the policy of the
+// node, or to the default one with reset, and shows the result.
+func (cli *CommandLine) policy(changes blockchain.Policy, set map[string]bool, reset bool) {
+	policy := loadPolicy()
+	if reset {
+		policy = blockchain.DefaultPolicy
+	}
+
+	if set["acceptnonstandard"] {
+		policy.AcceptNonStandard = changes.AcceptNonStandard
+	}
+	if set["dustrelayfee"] {
+		policy.DustRelayFee = changes.DustRelayFee
+	}
+	if set["datacarriersize"] {
+		policy.MaxDataCarrierSize = changes.MaxDataCarrierSize
+	}
+	if set["maxinputs"] {
+		policy.MaxInputs = changes.MaxInputs
+	}
+	if set["maxtxsize"] {
+		policy.MaxTxSize = changes.MaxTxSize
+	}
+	if set["maxwitnessitems"] {
+		policy.MaxWitnessItems = changes.MaxWitnessItems
+	}
+	if set["maxwitnessitemsize"] {
+		policy.MaxWitnessItemSize = changes.MaxWitnessItemSize
+	}
+	if set["minrelayfee"] {
+		policy.MinRelayFee = changes.MinRelayFee
+	}
+	if set["maxmempool"] {
+		policy.MaxMempoolSize = changes.MaxMempoolSize
+	}
+	if set["mempoolexpiry"] {
+		policy.MempoolExpiry = changes.MempoolExpiry
+	}
+
+	if len(set) > 0 {
+		if err := policy.Save(policyFile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	printJSON(policy)
+}
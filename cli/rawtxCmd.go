@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/goozt/seashell/blockchain"
+	"github.com/goozt/seashell/wallet"
+)
+
+func (cli *CommandLine) createRawTransaction(inputs string, payments []blockchain.Payment, lockTime uint, memo string) {
+	var txInputs []blockchain.TxInput
+
+	for _, entry := range strings.Split(inputs, ",") {
+		id, out, found := strings.Cut(strings.TrimSpace(entry), ":")
+		txId, err := hex.DecodeString(id)
+		if !found || err != nil {
+			log.Fatalf("input %q is not in TXID:INDEX form\n", entry)
+		}
+		index, err := strconv.Atoi(out)
+		if err != nil || index < 0 {
+			log.Fatalf("input %q has an invalid output index\n", entry)
+		}
+		txInputs = append(txInputs, blockchain.TxInput{Id: txId, Out: index})
+	}
+
+	for _, payment := range payments {
+		if !wallet.ValidateAddress(payment.Address) {
+			log.Fatalf("to address %s is not valid\n", payment.Address)
+		}
+	}
+
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	options := blockchain.SendOptions{LockTime: uint32(lockTime), Memo: []byte(memo)}
+	rt, err := blockchain.NewRawTransactionFromView(txInputs, blockchain.PaymentOutputs(payments), loadMempool(chain), options)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Println(hex.EncodeToString(rt.Serialize()))
+}
+
+// signRawTransaction signs with the spent outputs the raw transaction
+// carries, so it needs only the wallet and not the chain.
+func (cli *CommandLine) signRawTransaction(rawTx string) {
+	rt := parseRawTransaction(rawTx)
+
+	walletDB, _ := wallet.CreateWalletDB()
+	unsigned := rt.Tx.SignWithWalletDB(walletDB, rt.PreviousTransactions())
+
+	fmt.Println(hex.EncodeToString(rt.Serialize()))
+	if unsigned > 0 {
+		log.Fatalf("%d of %d inputs are not signed, their keys are not in the wallet\n", unsigned, len(rt.Tx.Inputs))
+	}
+}
+
+func (cli *CommandLine) decodeRawTransaction(rawTx string, asJSON bool) {
+	rt := parseRawTransaction(rawTx)
+
+	if asJSON {
+		printJSON(rt.Tx)
+		return
+	}
+
+	fmt.Println(rt.Tx)
+	for inId, out := range rt.PrevOutputs {
+		to := out.Script.Address()
+		if to == "" {
+			to = out.Script.String()
+		}
+		fmt.Printf("     Input %d spends %s paid to %s\n", inId, out.Value, to)
+	}
+	fee, err := rt.Fee()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("     Fee: %s\n", fee)
+}
+
+func (cli *CommandLine) submitRawTransaction(rawTx string, mine string) {
+	rt := parseRawTransaction(rawTx)
+	submitTransaction(&rt.Tx, mine)
+}
+
+func parseRawTransaction(rawTx string) *blockchain.RawTransaction {
+	data, err := hex.DecodeString(strings.TrimSpace(rawTx))
+	if err != nil {
+		log.Fatalln("raw transaction is not valid hex")
+	}
+
+	rt, err := blockchain.DeserializeRawTransaction(data)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return rt
+}
+
+// submitTransaction queues a transaction built outside of this wallet.
+func submitTransaction(tx *blockchain.Transaction, mine string) {
+	chain := blockchain.ContinueBlockChain(false, "")
+	defer chain.Close()
+
+	broadcast(loadMempool(chain), tx, mine)
+}
@@ -2,13 +2,19 @@ package cli
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/goozt/seashell/wallet"
 )
 
-func (cli *CommandLine) createWallet() {
+func (cli *CommandLine) createWallet(name string) {
+	keyType, err := wallet.ParseKeyType(name)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	walletDB, _ := wallet.CreateWalletDB()
-	address := walletDB.AddWallet()
+	address := walletDB.AddWallet(keyType)
 
 	walletDB.SaveFile()
 
@@ -23,3 +29,14 @@ func (cli *CommandLine) listAllAddresses() {
 		fmt.Println(address)
 	}
 }
+
+func (cli *CommandLine) publicKey(address string) {
+	walletDB, _ := wallet.CreateWalletDB()
+
+	w, ok := walletDB.Wallets[address]
+	if !ok {
+		log.Fatalln("address is not in the wallet")
+	}
+
+	fmt.Printf("%x\n", w.PublicKey)
+}
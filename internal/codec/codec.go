@@ -0,0 +1,122 @@
+// Package codec reads and writes the binary layout shared by the chain
+// database and the network messages: big-endian integers and a uint32
+// length prefix before every byte string or list.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Encoder struct {
+	bytes.Buffer
+}
+
+func (e *Encoder) PutUint32(v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	e.Write(buf[:])
+}
+
+func (e *Encoder) PutUint64(v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	e.Write(buf[:])
+}
+
+func (e *Encoder) PutBytes(data []byte) {
+	e.PutUint32(uint32(len(data)))
+	e.Write(data)
+}
+
+// Decoder reads the fields written by Encoder. The first error sticks in
+// Err, so callers read every field and check it once at the end.
+type Decoder struct {
+	data []byte
+	Err  error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+func (d *Decoder) take(n int, what string) []byte {
+	if d.Err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.Err = fmt.Errorf("unexpected end of data reading %s", what)
+		return nil
+	}
+
+	taken := d.data[:n]
+	d.data = d.data[n:]
+
+	return taken
+}
+
+func (d *Decoder) Uint32(what string) uint32 {
+	if buf := d.take(4, what); buf != nil {
+		return binary.BigEndian.Uint32(buf)
+	}
+	return 0
+}
+
+func (d *Decoder) Uint64(what string) uint64 {
+	if buf := d.take(8, what); buf != nil {
+		return binary.BigEndian.Uint64(buf)
+	}
+	return 0
+}
+
+// Bytes reads a byte string. An empty one is returned as nil.
+func (d *Decoder) Bytes(what string) []byte {
+	n := d.Uint32(what)
+	if d.Err != nil || n == 0 {
+		return nil
+	}
+	if uint64(n) > uint64(len(d.data)) {
+		d.Err = fmt.Errorf("%s of %d bytes exceeds the remaining data", what, n)
+		return nil
+	}
+
+	return append([]byte{}, d.take(int(n), what)...)
+}
+
+// Count reads a list length, rejecting counts that cannot fit in the
+// remaining data so a corrupt length cannot force a huge allocation.
+func (d *Decoder) Count(what string) int {
+	n := d.Uint32(what)
+	if d.Err == nil && uint64(n) > uint64(len(d.data)) {
+		d.Err = fmt.Errorf("%s count %d exceeds the remaining data", what, n)
+		return 0
+	}
+
+	return int(n)
+}
+
+// Version reads a version number and fails unless it is one of supported.
+func (d *Decoder) Version(what string, supported ...uint32) uint32 {
+	v := d.Uint32(what + " version")
+	if d.Err != nil {
+		return 0
+	}
+
+	for _, s := range supported {
+		if v == s {
+			return v
+		}
+	}
+	d.Err = fmt.Errorf("unsupported %s version %d", what, v)
+
+	return 0
+}
+
+// Finish fails if data is left after the last field, and returns Err.
+func (d *Decoder) Finish(what string) error {
+	if d.Err == nil && len(d.data) != 0 {
+		d.Err = fmt.Errorf("%d trailing bytes after %s", len(d.data), what)
+	}
+	return d.Err
+}
@@ -0,0 +1,50 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var e Encoder
+	e.PutUint32(7)
+	e.PutUint64(1 << 40)
+	e.PutBytes([]byte("shell"))
+	e.PutBytes(nil)
+
+	d := NewDecoder(e.Bytes())
+	if v := d.Uint32("a"); v != 7 {
+		t.Errorf("uint32 = %d, want 7", v)
+	}
+	if v := d.Uint64("b"); v != 1<<40 {
+		t.Errorf("uint64 = %d, want %d", v, uint64(1<<40))
+	}
+	if v := d.Bytes("c"); !bytes.Equal(v, []byte("shell")) {
+		t.Errorf("bytes = %q, want shell", v)
+	}
+	if v := d.Bytes("d"); v != nil {
+		t.Errorf("empty bytes = %#v, want nil", v)
+	}
+	if err := d.Finish("test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecoderRejectsBadLengths(t *testing.T) {
+	var e Encoder
+	e.PutUint32(1000)
+	e.PutUint32(0)
+
+	if d := NewDecoder(e.Bytes()); d.Count("item") != 0 || d.Err == nil {
+		t.Error("count larger than the data was accepted")
+	}
+	if d := NewDecoder(e.Bytes()); d.Bytes("item") != nil || d.Err == nil {
+		t.Error("byte string longer than the data was accepted")
+	}
+	if d := NewDecoder(e.Bytes()); d.Uint32("item") != 1000 || d.Finish("test") == nil {
+		t.Error("trailing bytes were accepted")
+	}
+	if d := NewDecoder(e.Bytes()); d.Version("item", 1, 2) != 0 || d.Err == nil {
+		t.Error("unsupported version was accepted")
+	}
+}
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goozt/seashell/blockchain"
+	"github.com/goozt/seashell/internal/codec"
+)
+
+// Messages are a command name of 12 bytes padded with zeros, a big-endian
+// uint32 payload length and the payload. Payloads use the layout of the
+// blockchain encoding, read and written with the codec package.
+//
+//	version: protocol version uint32, height int64, genesis hash bytes
+//	verack:  empty
+//	inv:     type uint32, hash count, each: hash bytes
+//	getdata: as inv
+//	block:   block bytes
+//	tx:      transaction bytes
+//
+// A node without a chain sends a version with height -1 and no genesis.
+const (
+	ProtocolVersion = 1
+
+	commandLength = 12
+	// maxPayloadSize leaves room for the encoding around a full block.
+	maxPayloadSize = 2 * blockchain.MaxBlockSize
+)
+
+const (
+	cmdVersion = "version"
+	cmdVerack  = "verack"
+	cmdInv     = "inv"
+	cmdGetData = "getdata"
+	cmdBlock   = "block"
+	cmdTx      = "tx"
+)
+
+type invType uint32
+
+const (
+	invTx invType = iota + 1
+	invBlock
+)
+
+func (t invType) String() string {
+	switch t {
+	case invTx:
+		return "transaction"
+	case invBlock:
+		return "block"
+	}
+	return fmt.Sprintf("type %d", uint32(t))
+}
+
+type message struct {
+	command string
+	payload []byte
+}
+
+type versionMessage struct {
+	version uint32
+	height  int64
+	genesis []byte
+}
+
+// invMessage announces objects in inv messages and requests them in getdata
+// messages.
+type invMessage struct {
+	kind   invType
+	hashes [][]byte
+}
+
+func writeMessage(w io.Writer, msg message) error {
+	if len(msg.command) > commandLength {
+		return fmt.Errorf("command %q is longer than %d bytes", msg.command, commandLength)
+	}
+
+	var header [commandLength + 4]byte
+	copy(header[:], msg.command)
+	binary.BigEndian.PutUint32(header[commandLength:], uint32(len(msg.payload)))
+
+	_, err := w.Write(append(header[:], msg.payload...))
+	return err
+}
+
+func readMessage(r io.Reader) (message, error) {
+	var header [commandLength + 4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return message{}, err
+	}
+
+	command := strings.TrimRight(string(header[:commandLength]), "\x00")
+	size := binary.BigEndian.Uint32(header[commandLength:])
+	if size > maxPayloadSize {
+		return message{}, fmt.Errorf("%s message of %d bytes exceeds %d", command, size, maxPayloadSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return message{}, err
+	}
+
+	return message{command, payload}, nil
+}
+
+func (v versionMessage) encode() message {
+	var e codec.Encoder
+	e.PutUint32(v.version)
+	e.PutUint64(uint64(v.height))
+	e.PutBytes(v.genesis)
+
+	return message{cmdVersion, e.Bytes()}
+}
+
+func decodeVersion(payload []byte) (versionMessage, error) {
+	d := codec.NewDecoder(payload)
+	v := versionMessage{
+		version: d.Uint32("protocol version"),
+		height:  int64(d.Uint64("height")),
+		genesis: d.Bytes("genesis hash"),
+	}
+	if err := d.Finish(cmdVersion); err != nil {
+		return v, fmt.Errorf("invalid %s message: %v", cmdVersion, err)
+	}
+
+	return v, nil
+}
+
+func (inv invMessage) encode(command string) message {
+	var e codec.Encoder
+	e.PutUint32(uint32(inv.kind))
+	e.PutUint32(uint32(len(inv.hashes)))
+	for _, hash := range inv.hashes {
+		e.PutBytes(hash)
+	}
+
+	return message{command, e.Bytes()}
+}
+
+func decodeInv(command string, payload []byte) (invMessage, error) {
+	d := codec.NewDecoder(payload)
+	inv := invMessage{kind: invType(d.Uint32("type"))}
+	for i, n := 0, d.Count("hash"); i < n && d.Err == nil; i++ {
+		inv.hashes = append(inv.hashes, d.Bytes("hash"))
+	}
+	if err := d.Finish(command); err != nil {
+		return inv, fmt.Errorf("invalid %s message: %v", command, err)
+	}
+	if inv.kind != invTx && inv.kind != invBlock {
+		return inv, fmt.Errorf("%s message has unknown %s", command, inv.kind)
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,559 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goozt/seashell/blockchain"
+)
+
+// Node keeps a chain and its memory pool in step with its peers. Blocks and
+// transactions are announced with inv messages and fetched with getdata.
+// After the handshake the taller of two nodes announces the blocks the
+// other lacks, and both announce their pool transactions.
+type Node struct {
+	chain   *blockchain.BlockChain
+	pool    *blockchain.Mempool
+	miner   string
+	genesis []byte
+
+	// mu serializes the use of the chain, which is not safe for concurrent
+	// use, and of the pool along with it.
+	mu sync.Mutex
+
+	peersMu  sync.Mutex
+	peers    map[*peer]bool
+	listener net.Listener
+
+	mine chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewNode serves chain and pool to peers. With a miner address set the node
+// mines the pool whenever it holds transactions.
+func NewNode(chain *blockchain.BlockChain, pool *blockchain.Mempool, miner string) *Node {
+	n := &Node{
+		chain: chain,
+		pool:  pool,
+		miner: miner,
+		peers: make(map[*peer]bool),
+		mine:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+	}
+
+	iter := chain.Iterator()
+	for {
+		block := iter.Next()
+		if len(block.PrevHash) == 0 {
+			n.genesis = block.Hash
+			break
+		}
+	}
+
+	return n
+}
+
+// Start listens on address and connects to peers, reconnecting to them
+// when the connection drops.
+func (n *Node) Start(address string, peers []string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	n.listener = listener
+	log.Printf("Listening on %s at height %d", listener.Addr(), n.chain.Height())
+
+	n.wg.Add(1)
+	go n.accept()
+
+	for _, address := range peers {
+		n.wg.Add(1)
+		go n.connect(address)
+	}
+
+	if n.miner != "" {
+		n.wg.Add(1)
+		go n.mineLoop()
+		n.wakeMiner()
+	}
+
+	return nil
+}
+
+// Close disconnects from every peer and waits for the node to stop using
+// the chain.
+func (n *Node) Close() {
+	close(n.quit)
+	n.listener.Close()
+
+	n.peersMu.Lock()
+	for p := range n.peers {
+		p.conn.Close()
+	}
+	n.peersMu.Unlock()
+
+	n.wg.Wait()
+}
+
+func (n *Node) accept() {
+	defer n.wg.Done()
+
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			select {
+			case <-n.quit:
+			default:
+				log.Printf("Stopped accepting connections: %v", err)
+			}
+			return
+		}
+
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.serve(&peer{conn: conn})
+		}()
+	}
+}
+
+func (n *Node) connect(address string) {
+	defer n.wg.Done()
+
+	for {
+		conn, err := net.DialTimeout("tcp", address, dialTimeout)
+		if err != nil {
+			log.Printf("Could not connect to %s: %v", address, err)
+		} else {
+			n.serve(&peer{conn: conn, outbound: true})
+		}
+
+		select {
+		case <-n.quit:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// serve reads the messages of p until it disconnects or breaks the
+// protocol. Peers are tracked from the start so that Close reaches them,
+// and relayed to once the handshake is done.
+func (n *Node) serve(p *peer) {
+	n.peersMu.Lock()
+	select {
+	case <-n.quit:
+		n.peersMu.Unlock()
+		p.conn.Close()
+		return
+	default:
+	}
+	n.peers[p] = false
+	n.peersMu.Unlock()
+
+	defer func() {
+		n.peersMu.Lock()
+		delete(n.peers, p)
+		n.peersMu.Unlock()
+		p.conn.Close()
+	}()
+
+	if p.outbound {
+		if err := p.send(n.version()); err != nil {
+			log.Printf("Peer %s: %v", p, err)
+			return
+		}
+	}
+
+	for {
+		msg, err := readMessage(p.conn)
+		if err != nil {
+			select {
+			case <-n.quit:
+			default:
+				if err == io.EOF {
+					log.Printf("Peer %s disconnected", p)
+				} else {
+					log.Printf("Peer %s: %v", p, err)
+				}
+			}
+			return
+		}
+
+		if err := n.handle(p, msg); err != nil {
+			log.Printf("Disconnecting peer %s: %v", p, err)
+			return
+		}
+	}
+}
+
+func (n *Node) version() message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return versionMessage{ProtocolVersion, int64(n.chain.Height()), n.genesis}.encode()
+}
+
+// handle answers msg from p. An error means p broke the protocol, blocks
+// and transactions the node refuses are only logged.
+func (n *Node) handle(p *peer, msg message) error {
+	switch msg.command {
+	case cmdVersion:
+		if p.version != nil {
+			return fmt.Errorf("sent a second version message")
+		}
+		v, err := decodeVersion(msg.payload)
+		if err != nil {
+			return err
+		}
+		if v.version != ProtocolVersion {
+			return fmt.Errorf("speaks protocol version %d instead of %d", v.version, ProtocolVersion)
+		}
+		if len(v.genesis) > 0 && !bytes.Equal(v.genesis, n.genesis) {
+			return fmt.Errorf("is on another chain with genesis block %x", v.genesis)
+		}
+		p.version = &v
+
+		if !p.outbound {
+			if err := p.send(n.version()); err != nil {
+				return err
+			}
+		}
+		if err := p.send(message{command: cmdVerack}); err != nil {
+			return err
+		}
+		if p.verack {
+			return n.ready(p)
+		}
+		return nil
+
+	case cmdVerack:
+		if p.verack {
+			return fmt.Errorf("sent a second verack message")
+		}
+		p.verack = true
+		if p.version != nil {
+			return n.ready(p)
+		}
+		return nil
+	}
+
+	if p.version == nil || !p.verack {
+		return fmt.Errorf("sent a %s message before the handshake", msg.command)
+	}
+
+	switch msg.command {
+	case cmdInv:
+		inv, err := decodeInv(msg.command, msg.payload)
+		if err != nil {
+			return err
+		}
+		return n.handleInv(p, inv)
+
+	case cmdGetData:
+		inv, err := decodeInv(msg.command, msg.payload)
+		if err != nil {
+			return err
+		}
+		return n.handleGetData(p, inv)
+
+	case cmdBlock:
+		block, err := blockchain.Deserialize(msg.payload)
+		if err != nil {
+			return err
+		}
+		return n.handleBlock(p, block)
+
+	case cmdTx:
+		tx, err := blockchain.DeserializeTransaction(msg.payload)
+		if err != nil {
+			return err
+		}
+		return n.handleTx(p, tx)
+	}
+
+	log.Printf("Peer %s sent an unknown %q message", p, msg.command)
+	return nil
+}
+
+// ready finishes the handshake with p: it announces the blocks p lacks,
+// judged by its height, and the pool transactions. The last block is
+// announced in any case, so that a peer on another branch fetches the
+// blocks back to where the branches split as orphan parents.
+func (n *Node) ready(p *peer) error {
+	n.peersMu.Lock()
+	n.peers[p] = true
+	n.peersMu.Unlock()
+
+	n.mu.Lock()
+	blocks := [][]byte{n.chain.LastHash}
+	height := n.chain.Height()
+	iter := n.chain.Iterator()
+	iter.Next()
+	for int64(height) > p.version.height+1 {
+		block := iter.Next()
+		blocks = append([][]byte{block.Hash}, blocks...)
+		if len(block.PrevHash) == 0 {
+			break
+		}
+		height = block.Height
+	}
+	var txs [][]byte
+	for _, entry := range n.pool.Entries() {
+		txs = append(txs, entry.Tx.Id)
+	}
+	n.mu.Unlock()
+
+	log.Printf("Connected to peer %s at height %d", p, p.version.height)
+
+	if len(blocks) > 0 {
+		if err := p.send(invMessage{invBlock, blocks}.encode(cmdInv)); err != nil {
+			return err
+		}
+	}
+	if len(txs) > 0 {
+		return p.send(invMessage{invTx, txs}.encode(cmdInv))
+	}
+
+	return nil
+}
+
+// handleInv requests the announced objects the node does not have yet.
+func (n *Node) handleInv(p *peer, inv invMessage) error {
+	var missing [][]byte
+
+	n.mu.Lock()
+	for _, hash := range inv.hashes {
+		if inv.kind == invBlock {
+			if _, err := n.chain.GetBlock(hash); err == nil {
+				continue
+			}
+		} else if _, ok := n.pool.Entry(hash); ok {
+			continue
+		}
+		missing = append(missing, hash)
+	}
+	n.mu.Unlock()
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return p.send(invMessage{inv.kind, missing}.encode(cmdGetData))
+}
+
+// handleGetData sends the requested blocks and pool transactions, and
+// skips those the node does not have.
+func (n *Node) handleGetData(p *peer, inv invMessage) error {
+	var replies []message
+
+	n.mu.Lock()
+	for _, hash := range inv.hashes {
+		if inv.kind == invBlock {
+			if block, err := n.chain.GetBlock(hash); err == nil {
+				replies = append(replies, message{cmdBlock, block.Serialize()})
+			}
+		} else if entry, ok := n.pool.Entry(hash); ok {
+			replies = append(replies, message{cmdTx, entry.Tx.Serialize()})
+		}
+	}
+	n.mu.Unlock()
+
+	for _, reply := range replies {
+		if err := p.send(reply); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleBlock adds block to the chain and relays it together with the
+// orphans it connected. The parent of an orphan is requested from p.
+func (n *Node) handleBlock(p *peer, block *blockchain.Block) error {
+	n.mu.Lock()
+	lastHash := n.chain.LastHash
+	connected, err := n.chain.ProcessBlock(block)
+	if err == nil {
+		if syncErr := n.pool.Sync(); syncErr != nil {
+			log.Printf("Could not update the memory pool: %v", syncErr)
+		}
+	}
+	n.mu.Unlock()
+
+	var missing *blockchain.MissingParentsError
+	if errors.As(err, &missing) {
+		return p.send(invMessage{invBlock, missing.Parents}.encode(cmdGetData))
+	}
+	if err != nil {
+		log.Printf("Rejected block %x from %s: %v", block.Hash, p, err)
+		return nil
+	}
+
+	if len(connected) == 0 {
+		log.Printf("Stored block %x at height %d on a side branch from %s", block.Hash, block.Height, p)
+		return nil
+	}
+	if !bytes.Equal(connected[0].PrevHash, lastHash) {
+		log.Printf("Switched to a branch with more work, from block %x at height %d on", connected[0].Hash, connected[0].Height)
+	}
+
+	var hashes [][]byte
+	for _, b := range connected {
+		log.Printf("Added block %x at height %d with %d transactions from %s", b.Hash, b.Height, len(b.Transactions), p)
+		hashes = append(hashes, b.Hash)
+	}
+	n.relay(p, invMessage{invBlock, hashes})
+	n.wakeMiner()
+
+	return nil
+}
+
+// handleTx adds tx to the memory pool and relays it. The parents of an
+// orphan are requested from p.
+func (n *Node) handleTx(p *peer, tx *blockchain.Transaction) error {
+	n.mu.Lock()
+	entry, err := n.pool.Add(tx)
+	n.mu.Unlock()
+
+	var missing *blockchain.MissingParentsError
+	if errors.As(err, &missing) {
+		return p.send(invMessage{invTx, missing.Parents}.encode(cmdGetData))
+	}
+	if err != nil {
+		log.Printf("Rejected transaction %x from %s: %v", tx.Id, p, err)
+		return nil
+	}
+
+	log.Printf("Added transaction %x from %s paying %s (%s)", tx.Id, p, entry.Fee, entry.FeeRate())
+	n.relay(p, invMessage{invTx, [][]byte{tx.Id}})
+	n.wakeMiner()
+
+	return nil
+}
+
+// relay announces inv to every peer past the handshake but from, which
+// sent it.
+func (n *Node) relay(from *peer, inv invMessage) {
+	msg := inv.encode(cmdInv)
+
+	n.peersMu.Lock()
+	var peers []*peer
+	for p, ready := range n.peers {
+		if ready && p != from {
+			peers = append(peers, p)
+		}
+	}
+	n.peersMu.Unlock()
+
+	for _, p := range peers {
+		if err := p.send(msg); err != nil {
+			log.Printf("Peer %s: %v", p, err)
+			p.conn.Close()
+		}
+	}
+}
+
+func (n *Node) wakeMiner() {
+	if n.miner == "" {
+		return
+	}
+
+	select {
+	case n.mine <- struct{}{}:
+	default:
+	}
+}
+
+// mineLoop mines a block whenever the pool holds transactions, and
+// announces it.
+func (n *Node) mineLoop() {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-n.quit:
+			return
+		case <-n.mine:
+		}
+
+		n.mu.Lock()
+		if n.pool.Len() == 0 {
+			n.mu.Unlock()
+			continue
+		}
+		template, err := n.pool.Mine(n.miner)
+		n.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Could not mine a block: %v", err)
+			continue
+		}
+
+		block := template.Block
+		log.Printf("Mined block %x at height %d with %d transactions and %s in fees", block.Hash, block.Height, len(block.Transactions), template.Fees)
+		n.relay(nil, invMessage{invBlock, [][]byte{block.Hash}})
+		n.wakeMiner()
+	}
+}
+
+// FetchGenesis downloads the genesis block of the node at address, to start
+// a chain that can sync with it.
+func FetchGenesis(address string) (*blockchain.Block, error) {
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return nil, err
+	}
+	if err := writeMessage(conn, versionMessage{ProtocolVersion, -1, nil}.encode()); err != nil {
+		return nil, err
+	}
+
+	var genesis []byte
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		switch msg.command {
+		case cmdVersion:
+			v, err := decodeVersion(msg.payload)
+			if err != nil {
+				return nil, err
+			}
+			if len(v.genesis) == 0 {
+				return nil, fmt.Errorf("node %s has no blockchain either", address)
+			}
+			genesis = v.genesis
+
+			if err := writeMessage(conn, message{command: cmdVerack}); err != nil {
+				return nil, err
+			}
+			request := invMessage{invBlock, [][]byte{genesis}}.encode(cmdGetData)
+			if err := writeMessage(conn, request); err != nil {
+				return nil, err
+			}
+
+		case cmdBlock:
+			block, err := blockchain.Deserialize(msg.payload)
+			if err != nil {
+				return nil, err
+			}
+			if genesis != nil && bytes.Equal(block.Hash, genesis) {
+				return block, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout    = 10 * time.Second
+	writeTimeout   = 30 * time.Second
+	reconnectDelay = 10 * time.Second
+)
+
+// peer is a connection to another node. Its version and verack fields are
+// only touched by the goroutine reading from it.
+type peer struct {
+	conn     net.Conn
+	outbound bool
+
+	version *versionMessage
+	verack  bool
+
+	writeMu sync.Mutex
+}
+
+func (p *peer) String() string {
+	return p.conn.RemoteAddr().String()
+}
+
+func (p *peer) send(msg message) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	if err := p.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+
+	return writeMessage(p.conn, msg)
+}
@@ -2,7 +2,9 @@ package wallet
 
 import (
 	"bytes"
+	"fmt"
 	"log"
+	"sort"
 
 	"crypto/sha256"
 
@@ -11,14 +13,18 @@ import (
 )
 
 const (
-	ChecksumLength = 4
-	version        = byte(0x00)
+	ChecksumLength  = 4
+	version         = byte(0x00)
+	multisigVersion = byte(0x05)
+	ed25519Version  = byte(0x21)
+
+	publicKeyHashLength = 20
 )
 
 func PublicKeyHash(pubKey []byte) []byte {
 	pubHash := sha256.Sum256(pubKey)
 
-	publicKeyHash := make([]byte, 20)
+	publicKeyHash := make([]byte, publicKeyHashLength)
 	sha3.ShakeSum256(publicKeyHash, pubHash[:])
 
 	return publicKeyHash
@@ -54,3 +60,68 @@ func ValidateAddress(address string) bool {
 
 	return bytes.Equal(actualChecksum, targetChecksum)
 }
+
+// ParseAddress decodes an address into its version byte and hash, checking
+// the base58 encoding and the checksum.
+func ParseAddress(address string) (byte, []byte, error) {
+	decoded, err := base58.Decode(address)
+	if err != nil {
+		return 0, nil, fmt.Errorf("address %q is not valid base58", address)
+	}
+	if len(decoded) != 1+publicKeyHashLength+ChecksumLength {
+		return 0, nil, fmt.Errorf("address %q has invalid length", address)
+	}
+
+	checksumIdx := len(decoded) - ChecksumLength
+	if !bytes.Equal(decoded[checksumIdx:], Checksum(decoded[:checksumIdx])) {
+		return 0, nil, fmt.Errorf("address %q has an invalid checksum", address)
+	}
+
+	return decoded[0], decoded[1:checksumIdx], nil
+}
+
+func AddressFromPubKeyHash(pubKeyHash []byte) []byte {
+	return encodeAddress(version, pubKeyHash)
+}
+
+func Ed25519Address(pubKeyHash []byte) []byte {
+	return encodeAddress(ed25519Version, pubKeyHash)
+}
+
+func IsEd25519Address(address string) bool {
+	decoded := Base58Decode([]byte(address))
+	return len(decoded) > 0 && decoded[0] == ed25519Version
+}
+
+func MultisigAddress(redeemScript []byte) []byte {
+	return encodeAddress(multisigVersion, PublicKeyHash(redeemScript))
+}
+
+func AddressFromScriptHash(scriptHash []byte) []byte {
+	return encodeAddress(multisigVersion, scriptHash)
+}
+
+func IsMultisigAddress(address string) bool {
+	decoded := Base58Decode([]byte(address))
+	return len(decoded) > 0 && decoded[0] == multisigVersion
+}
+
+func AddressHash(address string) []byte {
+	decoded := Base58Decode([]byte(address))
+	return decoded[1 : len(decoded)-ChecksumLength]
+}
+
+func SortPublicKeys(pubKeys [][]byte) [][]byte {
+	sorted := append([][]byte{}, pubKeys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	verHash := append([]byte{version}, hash...)
+	checksum := Checksum(verHash)
+
+	return Base58Encode(append(verHash, checksum...))
+}
@@ -3,15 +3,37 @@ package wallet
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"os"
 
+	"crypto/ed25519"
 	"crypto/elliptic"
 )
 
-const walletFile = "./db/wallets.data"
+const (
+	walletFile        = "./db/wallets.data"
+	walletFileVersion = 2
+)
+
+// storedWallet keeps the private key as a fixed width scalar, or the seed
+// for Ed25519 wallets. The public key is stored as created, so wallets made
+// before compressed keys keep their legacy key and address. Version 1 files
+// have no Type and decode as P-256.
+type storedWallet struct {
+	Type       KeyType
+	PrivateKey []byte
+	PublicKey  []byte
+}
+
+type walletFileContent struct {
+	Version   int
+	Wallets   map[string]storedWallet
+	Multisigs map[string][]byte
+}
 
 type WalletDB struct {
-	Wallets map[string]*Wallet
+	Wallets   map[string]*Wallet
+	Multisigs map[string][]byte
 }
 
 func CreateWalletDB() (*WalletDB, error) {
@@ -22,6 +44,7 @@ func CreateWalletDB() (*WalletDB, error) {
 
 	walletDB := WalletDB{}
 	walletDB.Wallets = make(map[string]*Wallet)
+	walletDB.Multisigs = make(map[string][]byte)
 
 	err := walletDB.LoadFile()
 
@@ -32,6 +55,16 @@ func (wdb WalletDB) GetWallet(address string) Wallet {
 	return *wdb.Wallets[address]
 }
 
+func (wdb WalletDB) FindWallet(pubKeyHash []byte) (*Wallet, bool) {
+	for _, w := range wdb.Wallets {
+		if bytes.Equal(PublicKeyHash(w.PublicKey), pubKeyHash) {
+			return w, true
+		}
+	}
+
+	return nil, false
+}
+
 func (wdb WalletDB) GetAllWallet() []string {
 	var addresses []string
 
@@ -42,8 +75,8 @@ func (wdb WalletDB) GetAllWallet() []string {
 	return addresses
 }
 
-func (wdb *WalletDB) AddWallet() string {
-	wallet := NewWallet()
+func (wdb *WalletDB) AddWallet(keyType KeyType) string {
+	wallet := NewWallet(keyType)
 	address := string(wallet.Address())
 
 	wdb.Wallets[address] = wallet
@@ -51,23 +84,65 @@ func (wdb *WalletDB) AddWallet() string {
 	return address
 }
 
+func (wdb *WalletDB) AddMultisig(redeemScript []byte) string {
+	address := string(MultisigAddress(redeemScript))
+
+	wdb.Multisigs[address] = redeemScript
+
+	return address
+}
+
 func (wdb *WalletDB) LoadFile() error {
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
 	}
 
-	var walletDB WalletDB
-
 	fileContent, err := os.ReadFile(walletFile)
 	HandleFatalErrors(err)
 
+	var stored walletFileContent
+
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	if err := decoder.Decode(&stored); err != nil || stored.Version == 0 {
+		return wdb.loadLegacyFile(fileContent)
+	}
+
+	wdb.Wallets = make(map[string]*Wallet)
+	for address, sw := range stored.Wallets {
+		if sw.Type == Ed25519 {
+			if len(sw.PrivateKey) != ed25519.SeedSize {
+				HandleFatalErrors(fmt.Errorf("invalid ed25519 seed for %s", address))
+			}
+			privateKey := ed25519.NewKeyFromSeed(sw.PrivateKey)
+			wdb.Wallets[address] = &Wallet{Type: Ed25519, Ed25519Key: privateKey, PublicKey: sw.PublicKey}
+			continue
+		}
+
+		privateKey, err := ParsePrivateKey(sw.PrivateKey)
+		HandleFatalErrors(err)
+
+		wdb.Wallets[address] = &Wallet{Type: P256, PrivateKey: privateKey, PublicKey: sw.PublicKey}
+	}
+	if stored.Multisigs != nil {
+		wdb.Multisigs = stored.Multisigs
+	}
+
+	return nil
+}
+
+func (wdb *WalletDB) loadLegacyFile(fileContent []byte) error {
+	var walletDB WalletDB
+
 	gob.Register(elliptic.P256())
 
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&walletDB)
+	err := decoder.Decode(&walletDB)
 	HandleFatalErrors(err)
 
 	wdb.Wallets = walletDB.Wallets
+	if walletDB.Multisigs != nil {
+		wdb.Multisigs = walletDB.Multisigs
+	}
 
 	return nil
 }
@@ -75,11 +150,24 @@ func (wdb *WalletDB) LoadFile() error {
 func (wdb *WalletDB) SaveFile() {
 	var content bytes.Buffer
 
-	gob.Register(elliptic.P256())
+	stored := walletFileContent{
+		Version:   walletFileVersion,
+		Wallets:   make(map[string]storedWallet),
+		Multisigs: wdb.Multisigs,
+	}
+	for address, w := range wdb.Wallets {
+		sw := storedWallet{Type: w.Type, PublicKey: w.PublicKey}
+		if w.Type == Ed25519 {
+			sw.PrivateKey = w.Ed25519Key.Seed()
+		} else {
+			sw.PrivateKey = EncodePrivateKey(w.PrivateKey)
+		}
+		stored.Wallets[address] = sw
+	}
 
 	encoder := gob.NewEncoder(&content)
 
-	err := encoder.Encode(wdb)
+	err := encoder.Encode(stored)
 	HandleFatalErrors(err)
 
 	err = os.WriteFile(walletFile, content.Bytes(), 0644)
@@ -0,0 +1,196 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+const (
+	PrivateKeyLength = 32
+	PublicKeyLength  = 33
+	SignatureLength  = 64
+	coordinateLength = 32
+	// Legacy r||s signatures dropped the leading zero bytes of r and s, which
+	// left them at most two bytes short in practice.
+	minLegacySignatureLength = SignatureLength - 2
+)
+
+// KeyType selects the signature scheme of a wallet.
+type KeyType byte
+
+const (
+	P256 KeyType = iota
+	Ed25519
+)
+
+var KeyTypes = []string{"p256", "ed25519"}
+
+func ParseKeyType(name string) (KeyType, error) {
+	for i, keyType := range KeyTypes {
+		if name == keyType {
+			return KeyType(i), nil
+		}
+	}
+
+	return P256, fmt.Errorf("unknown key type %q, use one of %v", name, KeyTypes)
+}
+
+func (t KeyType) String() string {
+	if int(t) < len(KeyTypes) {
+		return KeyTypes[t]
+	}
+	return fmt.Sprintf("KeyType(%d)", t)
+}
+
+// PublicKeyType tells the scheme of an encoded public key from its length,
+// Ed25519 keys being the only ones of exactly 32 bytes.
+func PublicKeyType(pubKey []byte) KeyType {
+	if len(pubKey) == ed25519.PublicKeySize {
+		return Ed25519
+	}
+	return P256
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// EncodePublicKey returns the 33 byte compressed SEC1 form of pub.
+func EncodePublicKey(pub *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y)
+}
+
+// ParsePublicKey accepts compressed and uncompressed SEC1 keys as well as
+// the legacy X||Y encoding, where either coordinate may have lost its
+// leading zero bytes.
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	switch {
+	case len(data) == PublicKeyLength && (data[0] == 0x02 || data[0] == 0x03):
+		x, y := elliptic.UnmarshalCompressed(curve, data)
+		if x == nil {
+			return nil, fmt.Errorf("invalid compressed public key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case len(data) == 2*coordinateLength+1 && data[0] == 0x04:
+		x, y := elliptic.Unmarshal(curve, data)
+		if x == nil {
+			return nil, fmt.Errorf("invalid uncompressed public key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case len(data) <= 2*coordinateLength:
+		for _, split := range legacySplits(len(data)) {
+			x := new(big.Int).SetBytes(data[:split])
+			y := new(big.Int).SetBytes(data[split:])
+			if curve.IsOnCurve(x, y) {
+				return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("invalid public key of %d bytes", len(data))
+}
+
+// EncodeSignature returns r||s as two 32 byte big-endian integers, with s
+// normalized to the lower half of the curve order.
+func EncodeSignature(r, s *big.Int) []byte {
+	s = normalizeS(s)
+
+	signature := make([]byte, SignatureLength)
+	r.FillBytes(signature[:coordinateLength])
+	s.FillBytes(signature[coordinateLength:])
+
+	return signature
+}
+
+// VerifySignature checks signature over hash with an encoded public key.
+// Ed25519 keys take plain Ed25519 signatures, P-256 keys a fixed width, DER
+// or legacy r||s signature.
+func VerifySignature(pubKey, hash, signature []byte) bool {
+	if PublicKeyType(pubKey) == Ed25519 {
+		return len(signature) == ed25519.SignatureSize && ed25519.Verify(pubKey, hash, signature)
+	}
+
+	pub, err := ParsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	if len(signature) > 0 && signature[0] == 0x30 {
+		var der ecdsaSignature
+		if rest, err := asn1.Unmarshal(signature, &der); err == nil && len(rest) == 0 {
+			return ecdsa.Verify(pub, hash, der.R, der.S)
+		}
+	}
+
+	if len(signature) < minLegacySignatureLength || len(signature) > SignatureLength {
+		return false
+	}
+
+	for _, split := range legacySplits(len(signature)) {
+		r := new(big.Int).SetBytes(signature[:split])
+		s := new(big.Int).SetBytes(signature[split:])
+		if ecdsa.Verify(pub, hash, r, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign produces a deterministic signature of hash, see signDeterministic.
+func Sign(privateKey ecdsa.PrivateKey, hash []byte) []byte {
+	r, s := signDeterministic(&privateKey, hash)
+
+	return EncodeSignature(r, s)
+}
+
+func EncodePrivateKey(privateKey ecdsa.PrivateKey) []byte {
+	return privateKey.D.FillBytes(make([]byte, PrivateKeyLength))
+}
+
+func ParsePrivateKey(data []byte) (ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+
+	d := new(big.Int).SetBytes(data)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return ecdsa.PrivateKey{}, fmt.Errorf("invalid private key")
+	}
+
+	x, y := curve.ScalarBaseMult(d.FillBytes(make([]byte, PrivateKeyLength)))
+
+	return ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}, nil
+}
+
+func normalizeS(s *big.Int) *big.Int {
+	n := elliptic.P256().Params().N
+	halfOrder := new(big.Int).Rsh(n, 1)
+
+	if s.Cmp(halfOrder) > 0 {
+		return new(big.Int).Sub(n, s)
+	}
+
+	return s
+}
+
+// legacySplits lists where a legacy a||b encoding of the given length may
+// be split, the even split first. Either half may be short when its
+// integer had leading zero bytes.
+func legacySplits(length int) []int {
+	splits := []int{length / 2}
+
+	for split := length - coordinateLength; split <= coordinateLength; split++ {
+		if split > 0 && split < length && split != length/2 {
+			splits = append(splits, split)
+		}
+	}
+
+	return splits
+}
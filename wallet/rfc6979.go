@@ -0,0 +1,119 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+)
+
+// nonceGenerator derives ECDSA nonces from the private key and message
+// hash as described in RFC 6979 section 3.2, using HMAC-SHA256.
+type nonceGenerator struct {
+	n    *big.Int
+	k, v []byte
+}
+
+func newNonceGenerator(privateKey *ecdsa.PrivateKey, hash []byte) *nonceGenerator {
+	n := privateKey.Curve.Params().N
+	size := (n.BitLen() + 7) / 8
+
+	x := privateKey.D.FillBytes(make([]byte, size))
+	h := new(big.Int).Mod(hashToInt(hash, n), n).FillBytes(make([]byte, size))
+
+	g := &nonceGenerator{
+		n: n,
+		k: make([]byte, sha256.Size),
+		v: make([]byte, sha256.Size),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	g.k = g.mac(g.v, []byte{0x00}, x, h)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, x, h)
+	g.v = g.mac(g.v)
+
+	return g
+}
+
+func (g *nonceGenerator) mac(data ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+func (g *nonceGenerator) next() *big.Int {
+	size := (g.n.BitLen() + 7) / 8
+
+	for {
+		var t []byte
+		for len(t) < size {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+
+		k := hashToInt(t, g.n)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+
+		g.retry()
+	}
+}
+
+func (g *nonceGenerator) retry() {
+	g.k = g.mac(g.v, []byte{0x00})
+	g.v = g.mac(g.v)
+}
+
+// hashToInt is bits2int from RFC 6979: the leftmost bits of data, as many
+// as the bit length of n.
+func hashToInt(data []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(data) > orderBytes {
+		data = data[:orderBytes]
+	}
+
+	result := new(big.Int).SetBytes(data)
+	if excess := len(data)*8 - orderBits; excess > 0 {
+		result.Rsh(result, uint(excess))
+	}
+
+	return result
+}
+
+// signDeterministic is ECDSA signing with an RFC 6979 nonce, so signing
+// the same hash with the same key always gives the same signature.
+func signDeterministic(privateKey *ecdsa.PrivateKey, hash []byte) (r, s *big.Int) {
+	curve := privateKey.Curve
+	n := curve.Params().N
+	e := hashToInt(hash, n)
+	nonces := newNonceGenerator(privateKey, hash)
+
+	for {
+		k := nonces.next()
+
+		x, _ := curve.ScalarBaseMult(k.FillBytes(make([]byte, (n.BitLen()+7)/8)))
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			nonces.retry()
+			continue
+		}
+
+		s = new(big.Int).Mul(r, privateKey.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			nonces.retry()
+			continue
+		}
+
+		return r, s
+	}
+}
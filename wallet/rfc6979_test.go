@@ -0,0 +1,103 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex integer %q", s)
+	}
+
+	return i
+}
+
+// rfc6979Key is the P-256 key of RFC 6979 appendix A.2.5.
+func rfc6979Key(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := hex.DecodeString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestSignDeterministicRFC6979(t *testing.T) {
+	privateKey, err := ParsePrivateKey(rfc6979Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hexInt(t, "60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6"); privateKey.X.Cmp(want) != 0 {
+		t.Fatalf("public key x = %x, want %x", privateKey.X, want)
+	}
+
+	// RFC 6979 appendix A.2.5, P-256 with SHA-256.
+	tests := []struct {
+		message string
+		k, r, s string
+	}{
+		{
+			message: "sample",
+			k:       "A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+			r:       "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			s:       "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			message: "test",
+			k:       "D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+			r:       "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			s:       "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+	}
+
+	for _, test := range tests {
+		hash := sha256.Sum256([]byte(test.message))
+
+		if k := newNonceGenerator(&privateKey, hash[:]).next(); k.Cmp(hexInt(t, test.k)) != 0 {
+			t.Errorf("%s: k = %X, want %s", test.message, k, test.k)
+		}
+
+		r, s := signDeterministic(&privateKey, hash[:])
+		if r.Cmp(hexInt(t, test.r)) != 0 {
+			t.Errorf("%s: r = %X, want %s", test.message, r, test.r)
+		}
+		if s.Cmp(hexInt(t, test.s)) != 0 {
+			t.Errorf("%s: s = %X, want %s", test.message, s, test.s)
+		}
+	}
+}
+
+func TestSignIsDeterministic(t *testing.T) {
+	privateKey, err := ParsePrivateKey(rfc6979Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := EncodePublicKey(&privateKey.PublicKey)
+	hash := sha256.Sum256([]byte("sample"))
+
+	first := Sign(privateKey, hash[:])
+	second := Sign(privateKey, hash[:])
+	if !bytes.Equal(first, second) {
+		t.Fatalf("signatures differ:\n%x\n%x", first, second)
+	}
+	if len(first) != SignatureLength {
+		t.Fatalf("signature is %d bytes, want %d", len(first), SignatureLength)
+	}
+	if !VerifySignature(pubKey, hash[:], first) {
+		t.Fatal("signature does not verify")
+	}
+
+	other := sha256.Sum256([]byte("test"))
+	if bytes.Equal(first, Sign(privateKey, other[:])) {
+		t.Fatal("different hashes gave the same signature")
+	}
+}
@@ -2,18 +2,28 @@ package wallet
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 )
 
+// Wallet holds a single key pair. PrivateKey is set for P-256 wallets and
+// Ed25519Key for Ed25519 ones.
 type Wallet struct {
+	Type       KeyType
 	PrivateKey ecdsa.PrivateKey
+	Ed25519Key ed25519.PrivateKey
 	PublicKey  []byte
 }
 
-func NewWallet() *Wallet {
+func NewWallet(keyType KeyType) *Wallet {
+	if keyType == Ed25519 {
+		pvtkey, pubkey := NewEd25519KeyPair()
+		return &Wallet{Type: Ed25519, Ed25519Key: pvtkey, PublicKey: pubkey}
+	}
+
 	pvtkey, pubkey := NewKeyPair()
-	return &Wallet{pvtkey, pubkey}
+	return &Wallet{Type: P256, PrivateKey: pvtkey, PublicKey: pubkey}
 }
 
 func NewKeyPair() (ecdsa.PrivateKey, []byte) {
@@ -22,18 +32,32 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	HandleFatalErrors(err)
 
-	public := append(private.PublicKey.X.Bytes(), private.Y.Bytes()...)
+	public := EncodePublicKey(&private.PublicKey)
 
 	return *private, public
 }
 
+func NewEd25519KeyPair() (ed25519.PrivateKey, []byte) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	HandleFatalErrors(err)
+
+	return private, public
+}
+
+func (w Wallet) Sign(hash []byte) []byte {
+	if w.Type == Ed25519 {
+		return ed25519.Sign(w.Ed25519Key, hash)
+	}
+
+	return Sign(w.PrivateKey, hash)
+}
+
 func (w Wallet) Address() []byte {
 	pubHash := PublicKeyHash(w.PublicKey)
-	verHash := append([]byte{version}, pubHash...)
-	checksum := Checksum(verHash)
-
-	hash := append(verHash, checksum...)
-	address := Base58Encode(hash)
+	address := AddressFromPubKeyHash(pubHash)
+	if w.Type == Ed25519 {
+		address = Ed25519Address(pubHash)
+	}
 
 	// fmt.Printf("public key: %x\n", w.PublicKey)
 	// fmt.Printf("public key hash: %x\n", pubHash)